@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 1プロセス1ノード構成（--mode=single）で、管理サーバーを単独で動かす（--mode=admin）
+// ノードのオブジェクトを持たないため、シードの/membershipからメンバーを辿り、
+// 各メンバーの/statusをHTTPで取得して/cluster・/nodes・/healthに答える
+
+// /statusのうち管理APIで使う項目
+type remoteStatus struct {
+	ID            string   `json:"id"`
+	Value         string   `json:"value"`
+	Version       Version  `json:"version"`
+	KeyCount      int      `json:"key_count"`
+	Tombstones    int      `json:"tombstone_count"`
+	Peers         []string `json:"peers"`
+	LastSeen      int64    `json:"last_seen"`
+	Fanout        int      `json:"fanout"`
+	PeerSelection string   `json:"peer_selection"`
+}
+
+// シードから辿ったメンバー一覧
+// シードがすべて応答しない場合は、前回得たメンバーに問い合わせる
+type memberDiscovery struct {
+	mu     sync.Mutex
+	seeds  []string
+	known  []MemberRecord
+	client *http.Client
+}
+
+func newMemberDiscovery(seeds []string) *memberDiscovery {
+	return &memberDiscovery{seeds: seeds, client: &http.Client{Timeout: 2 * time.Second}}
+}
+
+// 参加中のメンバー（アドレス順）
+func (d *memberDiscovery) members() []MemberRecord {
+	d.mu.Lock()
+	contacts := append([]string(nil), d.seeds...)
+	for _, record := range d.known {
+		contacts = append(contacts, record.Address)
+	}
+	d.mu.Unlock()
+
+	for _, contact := range contacts {
+		var message MembershipMessage
+		if err := d.get(contact, "/membership", &message); err != nil {
+			continue
+		}
+		members := []MemberRecord{}
+		for _, record := range message.Members {
+			if record.Status == MembershipJoined {
+				members = append(members, record)
+			}
+		}
+		sort.Slice(members, func(i, j int) bool { return members[i].Address < members[j].Address })
+
+		d.mu.Lock()
+		d.known = members
+		d.mu.Unlock()
+		return members
+	}
+	return []MemberRecord{}
+}
+
+func (d *memberDiscovery) get(address, path string, response interface{}) error {
+	resp, err := d.client.Get(fmt.Sprintf("http://%s%s", address, path))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// 各メンバーの/status（取得できなかったメンバーはnil）
+func (d *memberDiscovery) statuses(members []MemberRecord) []*remoteStatus {
+	statuses := make([]*remoteStatus, len(members))
+	var wg sync.WaitGroup
+	for i, member := range members {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			var status remoteStatus
+			if err := d.get(address, "/status", &status); err == nil {
+				statuses[i] = &status
+			}
+		}(i, member.Address)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// 各メンバーのピアを無向辺とみなしたトポロジー（メンバーの並び順の番号）
+func discoveredTopology(members []MemberRecord, statuses []*remoteStatus) *Topology {
+	addresses := make([]string, len(members))
+	peers := make([][]string, len(members))
+	for i, member := range members {
+		addresses[i] = member.Address
+		if statuses[i] != nil {
+			peers[i] = statuses[i].Peers
+		}
+	}
+	return topologyFromPeers("discovered", addresses, peers)
+}
+
+// defaultsはPOST /clusterで設定を検証するときの既定値
+// ctxがキャンセルされるまでブロックする
+func startStandaloneAdmin(ctx context.Context, adminPort int, seeds []string, defaults ClusterFile) error {
+	discovery := newMemberDiscovery(seeds)
+	mux := http.NewServeMux()
+
+	// クラスター情報エンドポイント（BasePortはメンバーの最小ポート）と設定ファイルの検証（POST）
+	mux.HandleFunc("/cluster", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			handleConfigValidation(w, r, defaults)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		members := discovery.members()
+		statuses := discovery.statuses(members)
+		topology := discoveredTopology(members, statuses)
+		info := ClusterInfo{
+			NodeCount: len(members),
+			AdminPort: adminPort,
+			Topology:  topology.Name,
+			StartedAt: clusterStartTime,
+
+			Connected: topology.Connected(),
+			Edges:     topology.Edges(),
+
+			Members: members,
+		}
+		for i, member := range members {
+			if port := addressPort(member.Address); i == 0 || port < info.BasePort {
+				info.BasePort = port
+			}
+		}
+		for _, status := range statuses {
+			if status != nil {
+				info.PeerSelection = status.PeerSelection
+				info.Fanout = status.Fanout
+				break
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	})
+
+	// 全ノード情報エンドポイント（/statusに応答したメンバーのみ）
+	mux.HandleFunc("/nodes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		members := discovery.members()
+		nodes := []NodeInfo{}
+		for i, status := range discovery.statuses(members) {
+			if status == nil {
+				continue
+			}
+			nodes = append(nodes, NodeInfo{
+				ID:         status.ID,
+				Port:       addressPort(members[i].Address),
+				Address:    members[i].Address,
+				Value:      status.Value,
+				Version:    status.Version,
+				KeyCount:   status.KeyCount,
+				Tombstones: status.Tombstones,
+				PeerCount:  len(status.Peers),
+				LastSeen:   status.LastSeen,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nodes)
+	})
+
+	// ヘルスチェックエンドポイント
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		members := discovery.members()
+		health := make([]HealthStatus, len(members))
+		allHealthy := true
+		for i, status := range discovery.statuses(members) {
+			health[i] = HealthStatus{ID: members[i].ID, Port: addressPort(members[i].Address), Healthy: status != nil}
+			if status == nil {
+				health[i].Error = "status unavailable"
+				allHealthy = false
+			}
+		}
+
+		response := map[string]interface{}{
+			"all_healthy": allHealthy,
+			"nodes":       health,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+
+	// ルートエンドポイント（管理サービスの情報）
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		info := map[string]interface{}{
+			"service": "gossip-cluster-admin",
+			"mode":    ModeAdmin,
+			"seeds":   seeds,
+			"endpoints": []string{
+				"/cluster - Members discovered from the seeds (GET), validate a config file (POST)",
+				"/nodes - Status of every discovered member",
+				"/health - Health check for every discovered member",
+			},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	})
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", adminPort))
+	if err != nil {
+		return err
+	}
+	log.Printf("Standalone admin server starting on port %d (seeds %v)", adminPort, seeds)
+	err = serveUntilDone(ctx, &http.Server{Handler: mux}, listener)
+	log.Printf("Standalone admin server stopped")
+	return err
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,16 +21,126 @@ type ClusterInfo struct {
 	AdminPort int    `json:"admin_port"`
 	Topology  string `json:"topology"`
 	StartedAt int64  `json:"started_at"`
+
+	PeerSelection string `json:"peer_selection"`
+	Fanout        int    `json:"fanout"`
+
+	// トポロジーの生成パラメータと辺（ノード番号の組）
+	TopologyK    int      `json:"topology_k,omitempty"`
+	TopologyP    float64  `json:"topology_p,omitempty"`
+	TopologySeed int64    `json:"topology_seed"`
+	Connected    bool     `json:"connected"`
+	Edges        [][2]int `json:"edges"`
+
+	// 現在参加中のメンバー（NodeCountはこの数）
+	Members []MemberRecord `json:"members"`
+
+	// 実際に使っている設定（--configと同じ形式）
+	Config *ClusterFile `json:"config,omitempty"`
 }
 
 // NodeInfo represents a node in the cluster for admin API
 type NodeInfo struct {
-	ID        string `json:"id"`
-	Port      int    `json:"port"`
+	ID         string  `json:"id"`
+	Port       int     `json:"port"`
+	Address    string  `json:"address"`
+	Value      string  `json:"value"`
+	Version    Version `json:"version"`
+	KeyCount   int     `json:"key_count"`
+	Tombstones int     `json:"tombstones"`
+	PeerCount  int     `json:"peer_count"`
+	LastSeen   int64   `json:"last_seen"`
+}
+
+// MerkleRootInfo reports the Merkle root hash of a node
+type MerkleRootInfo struct {
+	ID   string `json:"id"`
+	Root string `json:"root"`
+}
+
+// ResidueReport describes how far a rumor (the latest version of a key) spread
+type ResidueReport struct {
+	Key             string   `json:"key"`
+	LatestVersion   Version  `json:"latest_version"`
+	Informed        []string `json:"informed"`
+	Residue         []string `json:"residue"`
+	ResidueFraction float64  `json:"residue_fraction"`
+	Spreaders       []string `json:"spreaders"`
+	TrafficPerNode  float64  `json:"traffic_per_node"`
+}
+
+// NodeView is a node's current peer sampling view
+type NodeView struct {
+	ID      string      `json:"id"`
+	Address string      `json:"address"`
+	View    []ViewEntry `json:"view"`
+}
+
+// ViewReport summarizes the overlay formed by all partial views
+type ViewReport struct {
+	PeerSampling string         `json:"peer_sampling"`
+	Nodes        []NodeView     `json:"nodes"`
+	InDegree     map[string]int `json:"in_degree"`
+	Distribution map[int]int    `json:"in_degree_distribution"`
+	MinInDegree  int            `json:"min_in_degree"`
+	MaxInDegree  int            `json:"max_in_degree"`
+	MeanInDegree float64        `json:"mean_in_degree"`
+	Connected    bool           `json:"connected"`
+}
+
+// HyParViewInfo lists a node's HyParView active and passive views
+type HyParViewInfo struct {
+	ID      string   `json:"id"`
+	Address string   `json:"address"`
+	Active  []string `json:"active"`
+	Passive []string `json:"passive"`
+}
+
+// PlumtreeNodeInfo is a node's Plumtree eager/lazy peers and counters
+type PlumtreeNodeInfo struct {
+	ID      string        `json:"id"`
+	Address string        `json:"address"`
+	Eager   []string      `json:"eager"`
+	Lazy    []string      `json:"lazy"`
+	Stats   PlumtreeStats `json:"stats"`
+}
+
+// PlumtreeReport is the spanning tree formed by eager links plus
+// cluster-wide message counts for comparison with plain gossip traffic
+type PlumtreeReport struct {
+	Nodes          []PlumtreeNodeInfo `json:"nodes"`
+	TreeEdges      [][2]string        `json:"tree_edges"`
+	GossipSent     int64              `json:"gossip_sent"`
+	Redundant      int64              `json:"redundant"`
+	IHaveSent      int64              `json:"ihave_sent"`
+	GraftSent      int64              `json:"graft_sent"`
+	PruneSent      int64              `json:"prune_sent"`
+	TrafficSent    int64              `json:"traffic_messages_sent"`
+	RedundancyRate float64            `json:"redundancy_rate"`
+}
+
+// LivenessSummary counts how many nodes see a member in each SWIM state
+type LivenessSummary struct {
 	Address   string `json:"address"`
-	Value     string `json:"value"`
-	PeerCount int    `json:"peer_count"`
-	LastSeen  int64  `json:"last_seen"`
+	Alive     int    `json:"alive"`
+	Suspect   int    `json:"suspect"`
+	Dead      int    `json:"dead"`
+	Consensus string `json:"consensus"`
+}
+
+// LivenessReport aggregates every node's SWIM member view
+type LivenessReport struct {
+	FailureDetector string                       `json:"failure_detector"`
+	Views           map[string]map[string]string `json:"views"`
+	Members         []LivenessSummary            `json:"members"`
+}
+
+// PhiReport is the cluster-wide phi matrix: observer node -> peer -> phi
+type PhiReport struct {
+	FailureDetector string                        `json:"failure_detector"`
+	Threshold       float64                       `json:"threshold"`
+	Matrix          map[string]map[string]float64 `json:"matrix"`
+	Unavailable     map[string][]string           `json:"unavailable"`
 }
 
 // HealthStatus represents the health of a node
@@ -37,70 +153,135 @@ type HealthStatus struct {
 
 var clusterStartTime = time.Now().Unix()
 
-func startAdminServer(adminPort, nodeCount, basePort int) {
+// /healthで各ノードの応答を待つ上限
+const healthCheckTimeout = 2 * time.Second
+
+// ctxがキャンセルされるまで管理サーバーを動かす（処理中のリクエストは完了を待つ）
+func startAdminServer(ctx context.Context, adminPort int, manager *clusterManager) error {
 	mux := http.NewServeMux()
+	basePort, config := manager.basePort, manager.config
 
-	// クラスター情報エンドポイント
+	// クラスター情報エンドポイント（GET）と、起動せずに行う設定ファイルの検証（POST）
 	mux.HandleFunc("/cluster", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			handleConfigValidation(w, r, manager.defaults)
+			return
+		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
+		members := liveMembers()
+		effective := manager.ClusterFile()
+		topology := manager.Topology()
 		info := ClusterInfo{
-			NodeCount: nodeCount,
+			NodeCount: len(members),
 			BasePort:  basePort,
 			AdminPort: adminPort,
-			Topology:  "full-mesh",
+			Topology:  topology.Name,
 			StartedAt: clusterStartTime,
+
+			PeerSelection: config.PeerSelection,
+			Fanout:        config.Fanout,
+
+			TopologySeed: topology.Seed,
+			Connected:    topology.Connected(),
+			Edges:        topology.Edges(),
+
+			Members: members,
+			Config:  &effective,
+		}
+		switch topology.Name {
+		case TopologyKRegular:
+			info.TopologyK = topology.K
+		case TopologyErdosRenyi:
+			info.TopologyP = topology.P
+		case TopologyWattsStrogatz:
+			info.TopologyK = topology.K
+			info.TopologyP = topology.P
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(info)
 	})
 
-	// 全ノード情報エンドポイント
+	// 全ノード情報エンドポイント（GET）と、次の空きポートでのノード追加（POST）
 	mux.HandleFunc("/nodes", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
+			// 離脱済みのノードは含めない
+			nodes := []NodeInfo{}
+			for _, node := range liveNodes() {
+				nodes = append(nodes, buildNodeInfo(node))
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(nodes)
+		case http.MethodPost:
+			node, err := manager.AddNode()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(buildNodeInfo(node))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// ノードの削除（状態を引き継いで離脱してからHTTPサーバーを停止する）
+	mux.HandleFunc("/nodes/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		nodes := make([]NodeInfo, len(allNodes))
-		for i, node := range allNodes {
-			nodes[i] = NodeInfo{
-				ID:        node.ID,
-				Port:      basePort + i,
-				Address:   node.Address,
-				Value:     node.GetValue(),
-				PeerCount: len(node.Peers),
-				LastSeen:  node.LastSeen,
-			}
+		id := strings.TrimPrefix(r.URL.Path, "/nodes/")
+		result, err := manager.RemoveNode(id)
+		if errors.Is(err, ErrNodeNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(nodes)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "removed",
+			"id":         id,
+			"handoff_to": result.HandoffTo,
+		})
 	})
 
 	// ヘルスチェックエンドポイント
+	// 応答しないノードで止まらないよう、各ノードへの確認にはタイムアウトを付ける
+	healthClient := &http.Client{Timeout: healthCheckTimeout}
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		health := make([]HealthStatus, nodeCount)
+		nodes := clusterNodes()
+		health := make([]HealthStatus, len(nodes))
 		allHealthy := true
 
-		for i := 0; i < nodeCount; i++ {
-			port := basePort + i
+		for i, node := range nodes {
+			port := addressPort(node.Address)
 			health[i] = HealthStatus{
-				ID:   fmt.Sprintf("node-%d", i),
+				ID:   node.ID,
 				Port: port,
 			}
 
 			// 各ノードのステータスエンドポイントをチェック
-			resp, err := http.Get(fmt.Sprintf("http://localhost:%d/status", port))
+			resp, err := healthClient.Get(fmt.Sprintf("http://%s/status", node.Address))
 			if err != nil {
 				health[i].Healthy = false
 				health[i].Error = err.Error()
@@ -124,6 +305,155 @@ func startAdminServer(adminPort, nodeCount, basePort int) {
 		json.NewEncoder(w).Encode(response)
 	})
 
+	// 全ノードのMerkle木の根ハッシュ（同じ根を持つノード同士は同期済み）
+	mux.HandleFunc("/merkle", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		nodes := clusterNodes()
+		roots := make([]MerkleRootInfo, len(nodes))
+		groups := map[string][]string{}
+		for i, node := range nodes {
+			root := node.MerkleRoot()
+			roots[i] = MerkleRootInfo{ID: node.ID, Root: root}
+			groups[root] = append(groups[root], node.ID)
+		}
+
+		response := map[string]interface{}{
+			"all_agree": len(groups) <= 1,
+			"nodes":     roots,
+			"groups":    groups,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+
+	// 各ノードの部分ビューと入次数分布（オーバーレイが連結かつ均衡しているかの確認用）
+	mux.HandleFunc("/views", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := buildViewReport()
+		report.PeerSampling = config.PeerSampling
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
+	// HyParViewのアクティブ/パッシブビュー
+	// アクティブビューは双方向のはずなので、片方向の辺があればasymmetricに数える
+	mux.HandleFunc("/hyparview", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		nodes := clusterNodes()
+		views := make([]HyParViewInfo, len(nodes))
+		active := map[string][]string{}
+		for i, node := range nodes {
+			activeView, passiveView := node.HyParViewViews()
+			views[i] = HyParViewInfo{ID: node.ID, Address: node.Address, Active: activeView, Passive: passiveView}
+			active[node.Address] = activeView
+		}
+		asymmetric := 0
+		for address, peers := range active {
+			for _, peer := range peers {
+				if !containsString(active[peer], address) {
+					asymmetric++
+				}
+			}
+		}
+		connected := true
+		if len(nodes) > 0 {
+			connected = len(reachable(active, nodes[0].Address)) == len(nodes)
+		}
+
+		response := map[string]interface{}{
+			"nodes":            views,
+			"asymmetric_links": asymmetric,
+			"active_connected": connected,
+			"peer_sampling":    config.PeerSampling,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+
+	// 各ノードのSWIMによるメンバー生死の見え方と、その集計
+	mux.HandleFunc("/liveness", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := buildLivenessReport()
+		report.FailureDetector = config.FailureDetector
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
+	// 全ノードから見た各ピアのphi（観測ノード -> ピア -> phi）
+	mux.HandleFunc("/phi", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := PhiReport{
+			FailureDetector: config.FailureDetector,
+			Threshold:       config.Phi.Threshold,
+			Matrix:          map[string]map[string]float64{},
+			Unavailable:     map[string][]string{},
+		}
+		for _, node := range clusterNodes() {
+			row := map[string]float64{}
+			for peer, status := range node.PhiStatuses() {
+				row[peer] = status.Phi
+			}
+			report.Matrix[node.ID] = row
+			if unavailable := node.UnavailablePeers(); len(unavailable) > 0 {
+				report.Unavailable[node.ID] = unavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
+	// Plumtreeの全域木（eagerリンク）と冗長メッセージ数
+	mux.HandleFunc("/plumtree", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buildPlumtreeReport())
+	})
+
+	// rumorの残存率（最新バージョンを受け取っていないノード）
+	mux.HandleFunc("/residue", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			key = DefaultKey
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buildResidueReport(key))
+	})
+
 	// ルートエンドポイント（管理サービスの情報）
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -135,9 +465,17 @@ func startAdminServer(adminPort, nodeCount, basePort int) {
 			"service": "gossip-cluster-admin",
 			"version": "phase0",
 			"endpoints": []string{
-				"/cluster - Cluster configuration",
-				"/nodes - All node information",
+				"/cluster - Cluster configuration, live members and the effective config (GET), validate a config file without starting it (POST)",
+				"/nodes - Information for every live (not left) node (GET), add a node on the next free port (POST)",
+				"/nodes/{id} - Stop and remove a node after handing off its state (DELETE)",
 				"/health - Health check for all nodes",
+				"/merkle - Merkle root hashes for all nodes",
+				"/residue?key= - Nodes that never received the latest version of a key",
+				"/views - Peer sampling views and in-degree distribution",
+				"/hyparview - HyParView active and passive views",
+				"/plumtree - Plumtree spanning tree and redundant message counts",
+				"/liveness - SWIM member liveness as seen by each node",
+				"/phi - Phi accrual suspicion matrix (observer -> peer)",
 			},
 		}
 
@@ -145,7 +483,245 @@ func startAdminServer(adminPort, nodeCount, basePort int) {
 		json.NewEncoder(w).Encode(info)
 	})
 
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", adminPort))
+	if err != nil {
+		return err
+	}
 	log.Printf("Admin server starting on port %d (foreground)", adminPort)
 	log.Printf("Press Ctrl+C to stop all services")
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", adminPort), mux))
+	err = serveUntilDone(ctx, &http.Server{Handler: mux}, listener)
+	log.Printf("Admin server stopped")
+	return err
+}
+
+// 管理API用のノード情報
+func buildNodeInfo(node *Node) NodeInfo {
+	value, version := node.GetVersionedValue()
+	return NodeInfo{
+		ID:         node.ID,
+		Port:       addressPort(node.Address),
+		Address:    node.Address,
+		Value:      value,
+		Version:    version,
+		KeyCount:   len(node.Keys()),
+		Tombstones: node.TombstoneCount(),
+		PeerCount:  node.PeerCount(),
+		LastSeen:   node.GetLastSeen(),
+	}
+}
+
+// 全ノードのメンバーシップリストを突き合わせ、現在参加中のメンバーを返す
+// 同じアドレスについてはバージョンの大きいレコードを採用する
+func liveMembers() []MemberRecord {
+	latest := map[string]MemberRecord{}
+	for _, node := range clusterNodes() {
+		for _, record := range node.Membership() {
+			if current, ok := latest[record.Address]; !ok || record.Version > current.Version {
+				latest[record.Address] = record
+			}
+		}
+	}
+
+	members := []MemberRecord{}
+	for _, record := range latest {
+		if record.Status == MembershipJoined {
+			members = append(members, record)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Address < members[j].Address })
+	return members
+}
+
+// "host:port"形式のアドレスからポート番号を取り出す（取り出せなければ0）
+func addressPort(address string) int {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.Atoi(port)
+	return value
+}
+
+// 全ノードのキーのバージョンを比較し、最新バージョンを持たないノードを残存（residue）とする
+func buildResidueReport(key string) ResidueReport {
+	report := ResidueReport{Key: key, Informed: []string{}, Residue: []string{}, Spreaders: []string{}}
+	nodes := clusterNodes()
+
+	versions := make([]Version, len(nodes))
+	var messages int64
+	for i, node := range nodes {
+		if entries := node.entriesFor([]string{key}); len(entries) > 0 {
+			versions[i] = entries[0].Version
+		}
+		if versions[i].NewerThan(report.LatestVersion) {
+			report.LatestVersion = versions[i]
+		}
+		if containsString(node.HotRumors(), merkleEntryPrefix+key) {
+			report.Spreaders = append(report.Spreaders, node.ID)
+		}
+		traffic := node.Traffic()
+		messages += traffic.MessagesSentFull + traffic.MessagesSentDelta + traffic.MessagesSentDigest
+	}
+
+	for i, node := range nodes {
+		if versions[i] == report.LatestVersion {
+			report.Informed = append(report.Informed, node.ID)
+		} else {
+			report.Residue = append(report.Residue, node.ID)
+		}
+	}
+	if len(nodes) > 0 {
+		report.ResidueFraction = float64(len(report.Residue)) / float64(len(nodes))
+		report.TrafficPerNode = float64(messages) / float64(len(nodes))
+	}
+	return report
+}
+
+// 全ノードのビューを有向グラフとみなし、入次数分布と強連結性を求める
+func buildViewReport() ViewReport {
+	nodes := clusterNodes()
+	report := ViewReport{
+		Nodes:        make([]NodeView, len(nodes)),
+		InDegree:     map[string]int{},
+		Distribution: map[int]int{},
+	}
+
+	edges := map[string][]string{}
+	reverse := map[string][]string{}
+	for i, node := range nodes {
+		view := node.View()
+		report.Nodes[i] = NodeView{ID: node.ID, Address: node.Address, View: view}
+		// どのビューにも現れないノードも入次数0として数える
+		report.InDegree[node.Address] += 0
+		for _, entry := range view {
+			report.InDegree[entry.Address]++
+			edges[node.Address] = append(edges[node.Address], entry.Address)
+			reverse[entry.Address] = append(reverse[entry.Address], node.Address)
+		}
+	}
+
+	total := 0
+	report.MinInDegree = -1
+	for _, degree := range report.InDegree {
+		report.Distribution[degree]++
+		total += degree
+		if report.MinInDegree < 0 || degree < report.MinInDegree {
+			report.MinInDegree = degree
+		}
+		if degree > report.MaxInDegree {
+			report.MaxInDegree = degree
+		}
+	}
+	if len(report.InDegree) > 0 {
+		report.MeanInDegree = float64(total) / float64(len(report.InDegree))
+	} else {
+		report.MinInDegree = 0
+	}
+
+	// 1ノードから順方向・逆方向の両方で全ノードへ到達できれば強連結
+	if len(nodes) > 0 {
+		start := nodes[0].Address
+		report.Connected = len(reachable(edges, start)) == len(nodes) &&
+			len(reachable(reverse, start)) == len(nodes)
+	}
+	return report
+}
+
+func reachable(edges map[string][]string, start string) map[string]bool {
+	visited := map[string]bool{start: true}
+	stack := []string{start}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range edges[current] {
+			if !visited[next] {
+				visited[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+	return visited
+}
+
+// eagerリンクを無向辺にまとめて全域木とし、冗長メッセージ数を集計する
+func buildPlumtreeReport() PlumtreeReport {
+	nodes := clusterNodes()
+	report := PlumtreeReport{Nodes: make([]PlumtreeNodeInfo, len(nodes)), TreeEdges: [][2]string{}}
+	edges := map[[2]string]bool{}
+	for i, node := range nodes {
+		status := node.PlumtreeStatus()
+		report.Nodes[i] = PlumtreeNodeInfo{
+			ID:      node.ID,
+			Address: node.Address,
+			Eager:   status.Eager,
+			Lazy:    status.Lazy,
+			Stats:   status.Stats,
+		}
+		for _, peer := range status.Eager {
+			edge := [2]string{node.Address, peer}
+			if peer < node.Address {
+				edge = [2]string{peer, node.Address}
+			}
+			if !edges[edge] {
+				edges[edge] = true
+				report.TreeEdges = append(report.TreeEdges, edge)
+			}
+		}
+		report.GossipSent += status.Stats.GossipSent
+		report.Redundant += status.Stats.Redundant
+		report.IHaveSent += status.Stats.IHaveSent
+		report.GraftSent += status.Stats.GraftSent
+		report.PruneSent += status.Stats.PruneSent
+
+		traffic := node.Traffic()
+		report.TrafficSent += traffic.MessagesSentFull + traffic.MessagesSentDelta + traffic.MessagesSentDigest
+	}
+	sort.Slice(report.TreeEdges, func(i, j int) bool {
+		if report.TreeEdges[i][0] != report.TreeEdges[j][0] {
+			return report.TreeEdges[i][0] < report.TreeEdges[j][0]
+		}
+		return report.TreeEdges[i][1] < report.TreeEdges[j][1]
+	})
+	if report.GossipSent > 0 {
+		report.RedundancyRate = float64(report.Redundant) / float64(report.GossipSent)
+	}
+	return report
+}
+
+// 観測ノードごとのメンバー状態を集め、メンバーごとに多数派の状態を求める
+func buildLivenessReport() LivenessReport {
+	report := LivenessReport{Views: map[string]map[string]string{}, Members: []LivenessSummary{}}
+	summaries := map[string]*LivenessSummary{}
+	for _, node := range clusterNodes() {
+		view := map[string]string{}
+		for _, member := range node.MemberStatuses() {
+			view[member.Address] = member.State
+			summary, ok := summaries[member.Address]
+			if !ok {
+				summary = &LivenessSummary{Address: member.Address}
+				summaries[member.Address] = summary
+			}
+			switch member.State {
+			case MemberAlive:
+				summary.Alive++
+			case MemberSuspect:
+				summary.Suspect++
+			case MemberDead:
+				summary.Dead++
+			}
+		}
+		report.Views[node.ID] = view
+	}
+
+	for _, summary := range summaries {
+		summary.Consensus = MemberAlive
+		if summary.Suspect > summary.Alive && summary.Suspect >= summary.Dead {
+			summary.Consensus = MemberSuspect
+		} else if summary.Dead > summary.Alive && summary.Dead > summary.Suspect {
+			summary.Consensus = MemberDead
+		}
+		report.Members = append(report.Members, *summary)
+	}
+	sort.Slice(report.Members, func(i, j int) bool { return report.Members[i].Address < report.Members[j].Address })
+	return report
 }
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// ゴシップモード
+const (
+	GossipModePush     = "push"     // 状態を一方的に送る（従来の方式）
+	GossipModePushPull = "pushpull" // ダイジェスト比較によるanti-entropy
+	GossipModeMerkle   = "merkle"   // Merkle木の比較によるanti-entropy
+	GossipModeRumor    = "rumor"    // 新しい更新のみを拡散するrumor mongering
+)
+
+// ダイジェスト内の1キー分（値は含まずバージョンのみ）
+type DigestEntry struct {
+	Version Version     `json:"version"`
+	Clock   VectorClock `json:"clock,omitempty"` // vclockモード: 全siblingを結合したクロック
+	Deleted bool        `json:"deleted,omitempty"`
+}
+
+// anti-entropyの開始メッセージ（キーとバージョンの一覧）
+type Digest struct {
+	From    string                 `json:"from"`
+	Address string                 `json:"address"` // tombstoneの確認を記録するための送信元アドレス
+	Entries map[string]DigestEntry `json:"entries"`
+	States  map[string]string      `json:"states"` // CRDTキー -> 状態のハッシュ
+
+	// 比較対象のキーの限定（nilなら全キーが対象）
+	Scope *DigestScope `json:"scope,omitempty"`
+
+	// 参加・離脱のメンバーシップリスト（相乗り）
+	Membership []MemberRecord `json:"membership,omitempty"`
+}
+
+// ダイジェストの対象キー（Merkle木で食い違いを特定した場合に使用）
+type DigestScope struct {
+	Entries []string `json:"entries"`
+	States  []string `json:"states"`
+}
+
+func (s *DigestScope) hasEntry(key string) bool {
+	return s == nil || containsString(s.Entries, key)
+}
+
+func (s *DigestScope) hasState(key string) bool {
+	return s == nil || containsString(s.States, key)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ダイジェストへの応答
+// 受信側の方が新しい状態と、受信側が必要とするキーを返す
+type SyncResponse struct {
+	From        string       `json:"from"`
+	Entries     []Entry      `json:"entries"`
+	States      []StateEntry `json:"states"`
+	NeedEntries []string     `json:"need_entries"`
+	NeedStates  []string     `json:"need_states"`
+}
+
+// 現在のゴシップモード
+func (n *Node) GetGossipMode() string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.gossipMode
+}
+
+// ゴシップモードの変更（ノード単位で実行時に切り替え可能）
+func (n *Node) SetGossipMode(mode string) error {
+	if !validGossipMode(mode) {
+		return fmt.Errorf("unknown gossip mode: %s", mode)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.gossipMode != mode {
+		log.Printf("[%s] Gossip mode changed: %s -> %s", n.ID, n.gossipMode, mode)
+		n.gossipMode = mode
+	}
+	return nil
+}
+
+func validGossipMode(mode string) bool {
+	switch mode {
+	case GossipModePush, GossipModePushPull, GossipModeMerkle, GossipModeRumor, GossipModePlumtree:
+		return true
+	}
+	return false
+}
+
+// 手元の全キーのダイジェストを作成する
+func (n *Node) BuildDigest() Digest {
+	return n.BuildScopedDigest(nil)
+}
+
+// 対象キーを限定したダイジェストを作成する（scopeがnilなら全キー）
+func (n *Node) BuildScopedDigest(scope *DigestScope) Digest {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	digest := Digest{
+		From:    n.ID,
+		Address: n.Address,
+		Entries: map[string]DigestEntry{},
+		States:  map[string]string{},
+		Scope:   scope,
+
+		Membership: n.membershipLocked(),
+	}
+	for key, entry := range n.Store {
+		if scope.hasEntry(key) {
+			digest.Entries[key] = n.digestEntryLocked(entry)
+		}
+	}
+	for key, state := range n.States {
+		if scope.hasState(key) {
+			digest.States[key] = stateHash(state)
+		}
+	}
+	return digest
+}
+
+func (n *Node) digestEntryLocked(entry *Entry) DigestEntry {
+	d := DigestEntry{Version: entry.Version, Deleted: entry.Deleted}
+	if n.VersionMode == VersionModeVClock {
+		d.Clock = siblingsContext(entry.Siblings)
+	}
+	return d
+}
+
+// CRDT状態の内容ハッシュ
+func stateHash(state State) string {
+	data, err := state.Marshal()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 手元のエントリとダイジェストの比較
+// 手元の方が新しければlocalNewer、相手の方が新しければremoteNewer（並行なら両方true）
+func (n *Node) compareDigestEntry(local, remote DigestEntry) (localNewer, remoteNewer bool) {
+	if n.VersionMode == VersionModeVClock {
+		switch local.Clock.Compare(remote.Clock) {
+		case ClockAfter:
+			return true, false
+		case ClockBefore:
+			return false, true
+		case ClockConcurrent:
+			return true, true
+		}
+		return false, false
+	}
+	return local.Version.NewerThan(remote.Version), remote.Version.NewerThan(local.Version)
+}
+
+// ダイジェスト受信処理（anti-entropyの受信側）
+// 相手が手元と同じかより新しい削除済みのバージョンを持つtombstoneは、相手の確認済みとする
+func (n *Node) HandleDigest(digest Digest) SyncResponse {
+	n.recordHeartbeat(digest.From)
+	n.MergeMembership(digest.Membership, "")
+
+	response, acked := n.syncResponse(digest)
+	if digest.Address != "" {
+		n.recordTombstoneAcks(digest.Address, acked)
+	}
+	return response
+}
+
+// ダイジェストと手元の状態を比較して応答を作る
+// 相手が同じかより新しい削除済みのバージョンを持つtombstoneも返す
+func (n *Node) syncResponse(digest Digest) (SyncResponse, []Entry) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	response := SyncResponse{From: n.ID, Entries: []Entry{}, States: []StateEntry{}}
+	var acked []Entry
+
+	for key, remote := range digest.Entries {
+		entry, ok := n.Store[key]
+		if !ok {
+			response.NeedEntries = append(response.NeedEntries, key)
+			continue
+		}
+		localNewer, remoteNewer := n.compareDigestEntry(n.digestEntryLocked(entry), remote)
+		if localNewer {
+			response.Entries = append(response.Entries, entry.copy())
+		}
+		if remoteNewer {
+			response.NeedEntries = append(response.NeedEntries, key)
+		}
+		if entry.Deleted && remote.Deleted && !localNewer {
+			acked = append(acked, Entry{Key: key, Version: entry.Version, Deleted: true})
+		}
+	}
+	for key, entry := range n.Store {
+		if _, ok := digest.Entries[key]; !ok && digest.Scope.hasEntry(key) {
+			response.Entries = append(response.Entries, entry.copy())
+		}
+	}
+
+	// CRDTはマージが可換なため、ハッシュが異なれば双方向に送る
+	for key, remoteHash := range digest.States {
+		state, ok := n.States[key]
+		if !ok {
+			response.NeedStates = append(response.NeedStates, key)
+			continue
+		}
+		if stateHash(state) != remoteHash {
+			if entry, err := encodeStateEntry(key, state); err == nil {
+				response.States = append(response.States, entry)
+			}
+			response.NeedStates = append(response.NeedStates, key)
+		}
+	}
+	for key, state := range n.States {
+		if _, ok := digest.States[key]; ok || !digest.Scope.hasState(key) {
+			continue
+		}
+		if entry, err := encodeStateEntry(key, state); err == nil {
+			response.States = append(response.States, entry)
+		}
+	}
+
+	sort.Strings(response.NeedEntries)
+	sort.Strings(response.NeedStates)
+	return response, acked
+}
+
+// push-pull型: ダイジェストを送り、相手の新しい状態を受け取り、相手に足りない状態を返す
+func (n *Node) pushPullGossip(target string) error {
+	return n.exchangeDigest(target, n.BuildDigest())
+}
+
+// ダイジェスト交換の共通処理
+// 1. ダイジェスト送信 → 2. 相手の新しい状態と要求キーを受信 → 3. 要求された状態を送信
+func (n *Node) exchangeDigest(target string, digest Digest) error {
+	var response SyncResponse
+	size, err := n.postJSON(target, "/sync", digest, &response)
+	if err != nil {
+		return err
+	}
+	n.recordSent(size, trafficDigest)
+
+	pulled := 0
+	for _, entry := range response.Entries {
+		if n.MergeEntry(entry) {
+			pulled++
+		}
+	}
+	// 相手から受け取ったtombstoneと、相手が何も返さず要求もしなかった（同じバージョンを持つ）tombstoneは確認済み
+	n.recordTombstoneAcks(target, response.Entries)
+	n.recordTombstoneAcks(target, syncedTombstones(digest, response))
+	for _, state := range response.States {
+		if changed, err := n.MergeStateEntry(state); err != nil {
+			log.Printf("[%s] Rejected state '%s' from %s: %v", n.ID, state.Key, target, err)
+		} else if changed {
+			pulled++
+		}
+	}
+
+	pushed := 0
+	if len(response.NeedEntries) > 0 || len(response.NeedStates) > 0 {
+		message := GossipMessage{
+			From:      n.ID,
+			Entries:   n.entriesFor(response.NeedEntries),
+			States:    n.stateEntriesFor(response.NeedStates),
+			Timestamp: time.Now().Unix(),
+		}
+		size, err := n.sendHTTPMessage(target, message)
+		if err != nil {
+			return err
+		}
+		n.recordSent(size, trafficFull)
+		n.recordTombstoneAcks(target, message.Entries)
+		pushed = len(message.Entries) + len(message.States)
+	}
+
+	log.Printf("[%s] Anti-entropy with %s: pulled %d updates, pushed %d",
+		n.ID, target, pulled, pushed)
+	return nil
+}
+
+// ダイジェストで送ったtombstoneのうち、相手が同じバージョンを持っていたもの
+// 相手は手元より新しいか並行なら返し、古いか持っていなければ要求するため、どちらもなければ同じバージョン
+func syncedTombstones(digest Digest, response SyncResponse) []Entry {
+	returned := map[string]bool{}
+	for _, entry := range response.Entries {
+		returned[entry.Key] = true
+	}
+	var synced []Entry
+	for key, d := range digest.Entries {
+		if d.Deleted && !returned[key] && !containsString(response.NeedEntries, key) {
+			synced = append(synced, Entry{Key: key, Version: d.Version, Deleted: true})
+		}
+	}
+	return synced
+}
+
+// 指定キーのエントリ（存在するもののみ）
+func (n *Node) entriesFor(keys []string) []Entry {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	entries := []Entry{}
+	for _, key := range keys {
+		if entry, ok := n.Store[key]; ok {
+			entries = append(entries, entry.copy())
+		}
+	}
+	return entries
+}
+
+// 指定キーのCRDT状態（存在するもののみ）
+func (n *Node) stateEntriesFor(keys []string) []StateEntry {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	entries := []StateEntry{}
+	for _, key := range keys {
+		if state, ok := n.States[key]; ok {
+			if entry, err := encodeStateEntry(key, state); err == nil {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+)
+
+var ErrNodeNotFound = errors.New("node not found")
+
+// 実行中のノード一覧
+// 管理APIからノードを追加・削除できるため、参照はclusterNodes()のスナップショット経由で行う
+var (
+	nodesMu  sync.RWMutex
+	allNodes []*Node
+)
+
+// 実行中のノード一覧のスナップショット（起動順）
+func clusterNodes() []*Node {
+	nodesMu.RLock()
+	defer nodesMu.RUnlock()
+	return append([]*Node(nil), allNodes...)
+}
+
+// 離脱していないノード（起動順）
+func liveNodes() []*Node {
+	var nodes []*Node
+	for _, node := range clusterNodes() {
+		if !node.HasLeft() {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func findNode(id string) *Node {
+	for _, node := range clusterNodes() {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// ノードの起動・追加・削除と、ノード集合の変化に合わせたトポロジーの再適用
+type clusterManager struct {
+	mu             sync.Mutex
+	ctx            context.Context
+	basePort       int
+	adminPort      int
+	config         NodeConfig
+	topologyConfig TopologyConfig
+	topology       *Topology
+	// トポロジーの番号順のノード（離脱・削除したノードは除く）
+	members []*Node
+	// ノードの追加・削除でトポロジーを変えるときの乱数
+	rng *rand.Rand
+	// 次に作るノードの番号（削除したノードの番号は再利用しない）
+	nextIndex int
+	// 設定ファイルを重ねる前のフラグの値（管理APIでの設定の検証に使う）
+	defaults ClusterFile
+}
+
+func newClusterManager(plan *clusterPlan, defaults ClusterFile) *clusterManager {
+	return &clusterManager{
+		basePort:       plan.BasePort,
+		adminPort:      plan.AdminPort,
+		config:         plan.Config,
+		topologyConfig: plan.TopologyConfig,
+		rng:            rand.New(rand.NewSource(plan.TopologyConfig.Seed)),
+		defaults:       defaults,
+	}
+}
+
+// 現在適用されているトポロジー
+func (m *clusterManager) Topology() *Topology {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.topology
+}
+
+// 実際に使っている設定（設定ファイルの形式、ノードは生きているもの）
+func (m *clusterManager) ClusterFile() ClusterFile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	live := liveNodes()
+	specs := make([]NodeSpec, len(live))
+	for i, node := range live {
+		specs[i] = NodeSpec{ID: node.ID, Address: node.Address, Faults: node.faults}
+	}
+	plan := &clusterPlan{Config: m.config, TopologyConfig: m.topologyConfig, BasePort: m.basePort, AdminPort: m.adminPort}
+	return plan.clusterFile(specs, m.topology)
+}
+
+// 辺を指定したトポロジー（custom）は再生成せず、ノードのピアから辺を求める
+func (m *clusterManager) custom() bool {
+	return m.topologyConfig.Name == TopologyCustom
+}
+
+// 生きているノード数に対するトポロジーを生成する
+// hyparviewではノードがJOINでオーバーレイを作るため、初期ピアのない空のトポロジーになる
+func (m *clusterManager) generate(nodeCount int) (*Topology, error) {
+	if m.config.PeerSampling == PeerSamplingHyParView {
+		return &Topology{Name: PeerSamplingHyParView, Neighbors: make([][]int, nodeCount)}, nil
+	}
+	return generateTopology(m.topologyConfig, nodeCount)
+}
+
+// membersに対する現在のトポロジー
+// membersは追加・削除・離脱のたびにトポロジーと一緒に更新するため、通常はノード数が一致する
+// 一致しなければ（トポロジーを再適用できなかった場合）生成し直す
+func (m *clusterManager) currentLocked() (*Topology, error) {
+	if m.topology != nil && len(m.topology.Neighbors) == len(m.members) {
+		return m.topology, nil
+	}
+	return m.generate(len(m.members))
+}
+
+// 生きているノードの現在のピアを辺とするトポロジー
+func (m *clusterManager) peerTopology() *Topology {
+	live := liveNodes()
+	addresses := make([]string, len(live))
+	peers := make([][]string, len(live))
+	for i, node := range live {
+		addresses[i] = node.Address
+		peers[i] = node.gossipCandidates()
+	}
+	return topologyFromPeers(TopologyCustom, addresses, peers)
+}
+
+// 初期ノードを起動する
+// アドレスが使用中なら、それまでに起動したノードを停止してエラーを返す
+// ctxがキャンセルされると、追加したノードも含めて各ノードが停止する
+func (m *clusterManager) Start(ctx context.Context, specs []NodeSpec, topology *Topology) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ctx = ctx
+	m.topology = topology
+	for i, spec := range specs {
+		listener, err := net.Listen("tcp", spec.Address)
+		if err != nil {
+			m.stopLocked()
+			return err
+		}
+		node := m.startNodeLocked(spec, listener)
+		if m.config.PeerSampling == PeerSamplingHyParView && i > 0 {
+			contact := clusterNodes()[0].Address
+			node.spawn(func() {
+				if err := node.Join(contact); err != nil {
+					log.Printf("[%s] Failed to join overlay: %v", node.ID, err)
+				}
+			})
+		}
+	}
+	return nil
+}
+
+// ノードを作成してHTTPサーバーと定期処理を起動し、ノード一覧へ加える
+func (m *clusterManager) startNodeLocked(spec NodeSpec, listener net.Listener) *Node {
+	config := m.config
+	config.Faults = spec.Faults
+	node := createNode(spec.ID, spec.Address, spec.Peers, config)
+	m.nextIndex++
+	m.members = append(m.members, node)
+	node.onLeave = func() { m.nodeLeft(node) }
+	nodesMu.Lock()
+	allNodes = append(allNodes, node)
+	nodesMu.Unlock()
+
+	node.Start(m.ctx, listener)
+	return node
+}
+
+// 全ノードを並行して停止し、すべての停止（定期処理と送信中のメッセージの完了）を待つ
+func (m *clusterManager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopLocked()
+}
+
+func (m *clusterManager) stopLocked() {
+	nodes := clusterNodes()
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node *Node) {
+			defer wg.Done()
+			node.Stop()
+		}(node)
+	}
+	wg.Wait()
+	log.Printf("All %d nodes stopped", len(nodes))
+}
+
+// 次の空きポートで新しいノードを起動し、既存ノードのピアをトポロジーに合わせて更新する
+// トポロジーは作り直さず、現在のグラフへ新しいノードをつなぐ（既存の辺はできるだけ残す）
+// トポロジーを広げられない場合（k-regularでnodes*kが奇数になる等）はノードを作らない
+// customでは参加先のノードとだけつながる
+func (m *clusterManager) AddNode() (*Node, error) {
+	node, seed, err := m.addNode()
+	if err != nil {
+		return nil, err
+	}
+
+	// メンバーシップリストを交換して参加を知らせる（hyparviewではJOINも行う）
+	// seedへの送信とリトライの間も他の管理操作を止めないよう、ロックを外して行う
+	if seed != "" {
+		if err := node.JoinCluster(seed); err != nil {
+			log.Printf("[%s] Failed to join via %s: %v", node.ID, seed, err)
+		}
+	}
+	if m.custom() {
+		m.mu.Lock()
+		m.topology = m.peerTopology()
+		m.mu.Unlock()
+	}
+	return node, nil
+}
+
+// ノードを起動してトポロジーを適用し、参加先のアドレスを返す
+func (m *clusterManager) addNode() (*Node, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	live := m.members
+	var topology *Topology
+	if !m.custom() {
+		current, err := m.currentLocked()
+		if err != nil {
+			return nil, "", err
+		}
+		if topology, err = current.withNode(m.rng); err != nil {
+			return nil, "", err
+		}
+	}
+	address, listener, err := m.nextListener()
+	if err != nil {
+		return nil, "", err
+	}
+
+	spec := NodeSpec{ID: m.nextID(), Address: address, Faults: m.config.Faults}
+	if topology != nil {
+		for _, j := range topology.Neighbors[len(live)] {
+			spec.Peers = append(spec.Peers, live[j].Address)
+		}
+	}
+	node := m.startNodeLocked(spec, listener)
+	if topology != nil {
+		m.applyLocked(topology)
+	}
+	log.Printf("Added node %s on %s (%d live nodes)", node.ID, node.Address, len(live)+1)
+
+	seed := ""
+	if peers := node.gossipCandidates(); len(peers) > 0 {
+		seed = peers[0]
+	} else if len(live) > 0 {
+		seed = live[0].Address
+	}
+	return node, seed, nil
+}
+
+// 状態を引き継いで離脱させてからノードを停止し、トポロジーから除いて残りのノードへ再適用する
+// 離脱と停止（ピアへの送信と停止待ち）はロックを外して行い、他の管理操作を止めない
+// 除いた後のトポロジーを作れない場合（k-regularでnodes*kが奇数になる等）はノードを残してエラーを返す
+func (m *clusterManager) RemoveNode(id string) (LeaveResult, error) {
+	node, err := m.checkRemoval(id)
+	if err != nil {
+		return LeaveResult{}, err
+	}
+
+	result, err := node.Leave()
+	if err != nil && !errors.Is(err, ErrNodeLeft) {
+		log.Printf("[%s] Leave before removal failed: %v", node.ID, err)
+	}
+	node.Stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodesMu.Lock()
+	removed := false
+	for i, n := range allNodes {
+		if n == node {
+			allNodes = append(allNodes[:i], allNodes[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	nodesMu.Unlock()
+	if !removed {
+		// 同じノードの削除が並行して行われた
+		return result, nil
+	}
+
+	if m.custom() {
+		m.topology = m.peerTopology()
+	} else {
+		m.shrinkLocked(node)
+	}
+	log.Printf("Removed node %s (%d live nodes)", id, len(liveNodes()))
+	return result, nil
+}
+
+// ノードが/leaveで離脱したら、トポロジーから除いて残りのノードへ再適用する
+// 離脱したノードは/joinで再参加してもトポロジーには戻らず、参加先から得たピアを使う
+func (m *clusterManager) nodeLeft(node *Node) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.custom() {
+		m.topology = m.peerTopology()
+		return
+	}
+	m.shrinkLocked(node)
+}
+
+// 削除できるノードかを確かめる（トポロジーから除けなければエラー）
+func (m *clusterManager) checkRemoval(id string) (*Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node := findNode(id)
+	if node == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, id)
+	}
+	if index := m.memberIndex(node); index >= 0 && !m.custom() {
+		current, err := m.currentLocked()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := current.withoutNode(index, m.rng); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// トポロジー上の番号（含まれなければ-1）
+func (m *clusterManager) memberIndex(node *Node) int {
+	for i, member := range m.members {
+		if member == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// ノードをトポロジーから除き（既存の辺はできるだけ残す）、残りのノードへ再適用する
+// 確認後に他のノードが増減して除けなくなった場合は、残りのノードで生成し直す
+func (m *clusterManager) shrinkLocked(node *Node) {
+	index := m.memberIndex(node)
+	if index < 0 {
+		return
+	}
+	current, err := m.currentLocked()
+	m.members = append(m.members[:index:index], m.members[index+1:]...)
+	var topology *Topology
+	if err == nil {
+		topology, err = current.withoutNode(index, m.rng)
+	}
+	if err != nil {
+		log.Printf("Topology for %d nodes regenerated after removing %s: %v", len(m.members), node.ID, err)
+		if topology, err = m.generate(len(m.members)); err != nil {
+			log.Printf("Topology not reapplied after removing %s: %v", node.ID, err)
+			return
+		}
+	}
+	m.applyLocked(topology)
+}
+
+// membersのピアをトポロジーの隣接ノードで置き換える
+// hyparviewのアクティブビューはオーバーレイ自身が修復するため変更しない
+func (m *clusterManager) applyLocked(topology *Topology) {
+	m.topology = topology
+	if m.config.PeerSampling == PeerSamplingHyParView {
+		return
+	}
+	live := m.members
+	for i, node := range live {
+		if i >= len(topology.Neighbors) {
+			break
+		}
+		peers := make([]string, 0, len(topology.Neighbors[i]))
+		for _, j := range topology.Neighbors[i] {
+			if j < len(live) {
+				peers = append(peers, live[j].Address)
+			}
+		}
+		node.setPeers(peers)
+	}
+}
+
+// 設定ファイルのIDと重ならない、次のnode-番号
+func (m *clusterManager) nextID() string {
+	for findNode(fmt.Sprintf("node-%d", m.nextIndex)) != nil {
+		m.nextIndex++
+	}
+	return fmt.Sprintf("node-%d", m.nextIndex)
+}
+
+// basePort+次の番号から順に、どのノードも使っておらずlistenできるポートを探す
+func (m *clusterManager) nextListener() (string, net.Listener, error) {
+	used := map[string]bool{}
+	for _, node := range clusterNodes() {
+		used[node.Address] = true
+	}
+	for port := m.basePort + m.nextIndex; port <= 65535; port++ {
+		address := fmt.Sprintf("localhost:%d", port)
+		if used[address] {
+			continue
+		}
+		if listener, err := net.Listen("tcp", address); err == nil {
+			return address, listener, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no free port from %d", m.basePort+m.nextIndex)
+}
+
+// 停止後のクラスター全体の最終状態
+// Merkleルートがすべて一致していれば、全ノードの状態が収束している
+func logClusterSummary() {
+	nodes := liveNodes()
+	roots := map[string]bool{}
+	for _, node := range nodes {
+		roots[node.MerkleRoot()] = true
+	}
+	log.Printf("Final state: %d live nodes, %d distinct Merkle roots (converged=%t)", len(nodes), len(roots), len(roots) <= 1)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hassaku63/gossip-concept/internal/client"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// Number of leading nodes handed to every process as seeds
+const seedCount = 3
+
+// process is one supervised child: a single gossip node or the standalone admin server
+type process struct {
+	name string
+	args []string
+
+	mu  sync.Mutex
+	cmd *exec.Cmd
+}
+
+// supervisor starts every process and restarts the ones that exit unexpectedly
+type supervisor struct {
+	binary       string
+	restart      bool
+	restartDelay time.Duration
+
+	mu       sync.Mutex
+	stopping bool
+	wg       sync.WaitGroup
+}
+
+func main() {
+	var (
+		nodeCount    = flag.Int("nodes", 10, "Number of node processes to start")
+		basePort     = flag.Int("base-port", 18000, "Port of node-0 (node-i listens on base-port+i)")
+		adminPort    = flag.Int("admin-port", 17999, "Standalone admin server port (0 disables it)")
+		binary       = flag.String("binary", "./gossip-concept", "Path to the gossip-concept binary")
+		restart      = flag.Bool("restart", true, "Restart node processes that exit unexpectedly")
+		restartDelay = flag.Duration("restart-delay", time.Second, "Delay before restarting an exited process")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [-- node flags...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	// Everything after "--" is passed to every node process (e.g. --gossip-mode=pushpull)
+	nodeArgs := flag.Args()
+
+	if *nodeCount < 1 {
+		log.Fatalf("Node count must be at least 1: %d", *nodeCount)
+	}
+	if _, err := os.Stat(*binary); err != nil {
+		log.Fatalf("Binary not found (run 'go build .' first): %v", err)
+	}
+
+	fmt.Printf("%s=== Starting Gossip Cluster (one process per node) ===%s\n", colorGreen, colorReset)
+	fmt.Printf("  Nodes: %d\n", *nodeCount)
+	fmt.Printf("  Base Port: %d\n", *basePort)
+	fmt.Printf("  Binary: %s\n", *binary)
+	if len(nodeArgs) > 0 {
+		fmt.Printf("  Node flags: %v\n", nodeArgs)
+	}
+	fmt.Println()
+
+	s := &supervisor{binary: *binary, restart: *restart, restartDelay: *restartDelay}
+	processes := buildProcesses(*nodeCount, *basePort, *adminPort, nodeArgs)
+	for _, p := range processes {
+		s.start(p)
+	}
+
+	go reportHealth(*basePort, *nodeCount, *adminPort)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	fmt.Printf("\n%sReceived %s, stopping %d processes...%s\n", colorYellow, sig, len(processes), colorReset)
+	s.stop(processes)
+	fmt.Printf("%sAll processes stopped.%s\n", colorGreen, colorReset)
+}
+
+// buildProcesses returns the node processes followed by the admin server.
+// Every node joins through the first seedCount nodes (other than itself),
+// so a restarted node rejoins even when node-0 is down
+func buildProcesses(nodeCount, basePort, adminPort int, nodeArgs []string) []*process {
+	var seeds []string
+	for i := 0; i < nodeCount && i < seedCount; i++ {
+		seeds = append(seeds, fmt.Sprintf("localhost:%d", basePort+i))
+	}
+
+	var processes []*process
+	for i := 0; i < nodeCount; i++ {
+		address := fmt.Sprintf("localhost:%d", basePort+i)
+		args := []string{
+			"--mode=single",
+			fmt.Sprintf("--id=node-%d", i),
+			"--listen=" + address,
+		}
+		if others := without(seeds, address); len(others) > 0 {
+			args = append(args, "--seeds="+strings.Join(others, ","))
+		}
+		processes = append(processes, &process{name: fmt.Sprintf("node-%d", i), args: append(args, nodeArgs...)})
+	}
+
+	if adminPort > 0 {
+		processes = append(processes, &process{
+			name: "admin",
+			args: []string{"--mode=admin", fmt.Sprintf("--admin-port=%d", adminPort), "--seeds=" + strings.Join(seeds, ",")},
+		})
+	}
+	return processes
+}
+
+// start runs the process in the background, restarting it until the supervisor stops
+func (s *supervisor) start(p *process) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			cmd, err := s.spawn(p)
+			if err != nil {
+				log.Printf("Failed to start %s: %v", p.name, err)
+				return
+			}
+			if cmd == nil {
+				return
+			}
+			log.Printf("Started %s (pid %d)", p.name, cmd.Process.Pid)
+
+			err = cmd.Wait()
+			if s.isStopping() {
+				return
+			}
+			log.Printf("%s%s exited: %v%s", colorRed, p.name, err, colorReset)
+			if !s.restart {
+				return
+			}
+			time.Sleep(s.restartDelay)
+			if s.isStopping() {
+				return
+			}
+			log.Printf("%sRestarting %s%s", colorYellow, p.name, colorReset)
+		}
+	}()
+}
+
+// spawn starts a child and publishes it as p.cmd while holding s.mu, so stop
+// either sees the new child and signals it or has already set stopping and
+// no child is started. It returns a nil cmd once the supervisor is stopping
+func (s *supervisor) spawn(p *process) (*exec.Cmd, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return nil, nil
+	}
+
+	cmd := exec.Command(s.binary, p.args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.cmd = cmd
+	p.mu.Unlock()
+	return cmd, nil
+}
+
+func (s *supervisor) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+// stop sends SIGTERM to every running process and waits for all of them to exit
+func (s *supervisor) stop(processes []*process) {
+	s.mu.Lock()
+	s.stopping = true
+	s.mu.Unlock()
+
+	for _, p := range processes {
+		p.mu.Lock()
+		if p.cmd != nil && p.cmd.Process != nil {
+			p.cmd.Process.Signal(syscall.SIGTERM)
+		}
+		p.mu.Unlock()
+	}
+	s.wg.Wait()
+}
+
+// reportHealth prints the same startup summary start-cluster.sh used to print
+func reportHealth(basePort, nodeCount, adminPort int) {
+	time.Sleep(2 * time.Second)
+
+	gossipClient := client.NewGossipClient()
+	healthy := 0
+	fmt.Printf("%sHealth check:%s\n", colorGreen, colorReset)
+	for i := 0; i < nodeCount; i++ {
+		port := basePort + i
+		status, err := gossipClient.GetStatus(port)
+		if err != nil {
+			fmt.Printf("  node-%d (port %d): %s✗%s\n", i, port, colorRed, colorReset)
+			continue
+		}
+		fmt.Printf("  node-%d (port %d): %s✓%s value='%s' peers=%d\n", i, port, colorGreen, colorReset, status.Value, len(status.Peers))
+		healthy++
+	}
+
+	fmt.Println()
+	if healthy == nodeCount {
+		fmt.Printf("%sCluster ready! All %d nodes are healthy.%s\n", colorGreen, nodeCount, colorReset)
+	} else {
+		fmt.Printf("%sWarning: Only %d/%d nodes are healthy.%s\n", colorYellow, healthy, nodeCount, colorReset)
+	}
+
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Printf("  Check status:     curl localhost:%d/status | jq\n", basePort)
+	fmt.Printf("  Trigger gossip:   curl -X POST localhost:%d/trigger\n", basePort)
+	fmt.Printf("  Set value:        curl -X POST 'localhost:%d/set?value=hello'\n", basePort)
+	if adminPort > 0 {
+		fmt.Printf("  Cluster members:  curl localhost:%d/cluster | jq\n", adminPort)
+	}
+	fmt.Println("  Crash a node:     kill -9 <pid>  (the launcher restarts it)")
+	fmt.Println("  Stop cluster:     Ctrl+C")
+	fmt.Println()
+}
+
+func without(list []string, s string) []string {
+	var result []string
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -23,6 +23,8 @@ func main() {
 		adminPort = flag.Int("admin-port", 17999, "Admin service port")
 		basePort  = flag.Int("base-port", 0, "Base port (auto-detect from admin API if 0)")
 		nodeCount = flag.Int("nodes", 0, "Number of nodes (auto-detect from admin API if 0)")
+		key       = flag.String("key", "", "Key to observe (default key of each node if empty)")
+		mode      = flag.String("trigger-mode", client.TriggerRandom, "Trigger mode: random, recursive or random-recursive")
 	)
 	flag.Parse()
 
@@ -63,16 +65,30 @@ func main() {
 	fmt.Printf("  Base Port: %d\n", actualBasePort)
 	fmt.Printf("  Nodes: %d\n", actualNodeCount)
 	fmt.Printf("  Max Rounds: %d\n", *maxRounds)
+	fmt.Printf("  Trigger Mode: %s\n", *mode)
+	if *key != "" {
+		fmt.Printf("  Key: %s\n", *key)
+	}
 	fmt.Printf("\n")
 
 	// Set new value on node-0
 	newValue := fmt.Sprintf("converged-%d", time.Now().Unix())
 	fmt.Printf("Setting new value on node-0: '%s'\n", newValue)
 
-	if err := gossipClient.SetValue(actualBasePort, newValue); err != nil {
+	if err := gossipClient.SetKey(actualBasePort, *key, newValue); err != nil {
 		log.Fatalf("Failed to set value on node-0: %v", err)
 	}
 
+	// Read back the version assigned by node-0 so convergence is judged
+	// on (value, version) rather than string equality alone
+	reader := stateReader{client: gossipClient, key: *key}
+	source, err := reader.read(actualBasePort)
+	if err != nil {
+		log.Fatalf("Failed to read version from node-0: %v", err)
+	}
+	expected := expectedState{Value: newValue, Version: source.Version}
+	fmt.Printf("Assigned version: clock=%d origin=%s\n", expected.Version.Clock, expected.Version.NodeID)
+
 	fmt.Println("Starting gossip propagation...")
 	fmt.Println()
 
@@ -83,15 +99,15 @@ func main() {
 	fmt.Println("Initial state:")
 	for i := 0; i < actualNodeCount; i++ {
 		port := actualBasePort + i
-		status, err := gossipClient.GetStatus(port)
+		state, err := reader.read(port)
 		if err != nil {
 			fmt.Printf("  node-%d: ✗ (error: %v)\n", i, err)
 			nodeUpdated[i] = false
-		} else if status.Value == newValue {
+		} else if expected.matches(state) {
 			fmt.Printf("  node-%d: ✓ (source)\n", i)
 			nodeUpdated[i] = true
 		} else {
-			fmt.Printf("  node-%d: ✗ '%s'\n", i, status.Value)
+			fmt.Printf("  node-%d: ✗ '%s'\n", i, state.Value)
 			nodeUpdated[i] = false
 		}
 	}
@@ -119,18 +135,21 @@ func main() {
 			senderIndex := updatedNodes[rand.Intn(len(updatedNodes))]
 			senderPort := actualBasePort + senderIndex
 
-			trigger, err := gossipClient.TriggerGossip(senderPort)
+			trigger, err := gossipClient.TriggerGossipMode(senderPort, *mode)
 			if err != nil {
 				fmt.Printf("Round %d: node-%d → error (%v)", rounds, senderIndex, err)
-			} else if trigger.Status == "sent" && trigger.Target != "" {
-				// Extract target port from target address
-				targetPort := extractPortFromAddress(trigger.Target)
-				if targetPort > 0 {
-					targetNode := targetPort - actualBasePort
-					fmt.Printf("Round %d: node-%d → %d ", rounds, senderIndex, targetNode)
-				} else {
-					fmt.Printf("Round %d: node-%d → %s ", rounds, senderIndex, trigger.Target)
+			} else if trigger.Status == "sent" && len(trigger.Targets) > 0 {
+				fmt.Printf("Round %d: node-%d →", rounds, senderIndex)
+				for _, target := range trigger.Targets {
+					// Extract target port from target address
+					targetPort := extractPortFromAddress(target)
+					if targetPort > 0 {
+						fmt.Printf(" %d", targetPort-actualBasePort)
+					} else {
+						fmt.Printf(" %s", target)
+					}
 				}
+				fmt.Printf(" ")
 			}
 		}
 
@@ -143,8 +162,8 @@ func main() {
 
 		for i := 0; i < actualNodeCount; i++ {
 			port := actualBasePort + i
-			status, err := gossipClient.GetStatus(port)
-			if err == nil && status.Value == newValue {
+			state, err := reader.read(port)
+			if err == nil && expected.matches(state) {
 				if !nodeUpdated[i] {
 					newlyUpdated = append(newlyUpdated, i)
 					nodeUpdated[i] = true
@@ -178,7 +197,43 @@ func main() {
 	fmt.Println()
 
 	// Show results
-	showResults(converged, rounds, actualNodeCount, newValue, actualBasePort, gossipClient)
+	showResults(converged, rounds, actualNodeCount, expected, actualBasePort, reader)
+}
+
+// expectedState is the value and version every node should converge to
+type expectedState struct {
+	Value   string
+	Version client.Version
+}
+
+func (e expectedState) matches(state *client.Entry) bool {
+	return state.Value == e.Value && state.Version == e.Version
+}
+
+// stateReader reads the observed key from a node: the default key via
+// /status, or a named key via /get
+type stateReader struct {
+	client *client.GossipClient
+	key    string
+}
+
+func (r stateReader) read(port int) (*client.Entry, error) {
+	if r.key == "" {
+		status, err := r.client.GetStatus(port)
+		if err != nil {
+			return nil, err
+		}
+		return &client.Entry{Value: status.Value, Version: status.Version}, nil
+	}
+
+	entry, found, err := r.client.GetKey(port, r.key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return &client.Entry{Key: r.key}, nil
+	}
+	return entry, nil
 }
 
 func extractPortFromAddress(address string) int {
@@ -204,7 +259,7 @@ func parseInt(s string) int {
 	return result
 }
 
-func showResults(converged bool, rounds, nodeCount int, expectedValue string, basePort int, gossipClient *client.GossipClient) {
+func showResults(converged bool, rounds, nodeCount int, expected expectedState, basePort int, reader stateReader) {
 	fmt.Println("=== Results ===")
 	fmt.Println()
 
@@ -238,13 +293,13 @@ func showResults(converged bool, rounds, nodeCount int, expectedValue string, ba
 		fmt.Println("Final state:")
 		for i := 0; i < nodeCount; i++ {
 			port := basePort + i
-			status, err := gossipClient.GetStatus(port)
+			state, err := reader.read(port)
 			if err != nil {
 				fmt.Printf("  node-%d: ✗ (error: %v)\n", i, err)
-			} else if status.Value == expectedValue {
+			} else if expected.matches(state) {
 				fmt.Printf("  node-%d: ✓\n", i)
 			} else {
-				fmt.Printf("  node-%d: ✗ (still has '%s')\n", i, status.Value)
+				fmt.Printf("  node-%d: ✗ (still has '%s' @%d/%s)\n", i, state.Value, state.Version.Clock, state.Version.NodeID)
 			}
 		}
 	}
@@ -67,42 +67,59 @@ func main() {
 		actualNodeCount = *nodeCount
 	}
 
+	// Check if source node is healthy and read its fanout
+	status, err := gossipClient.GetStatus(actualBasePort)
+	if err != nil {
+		log.Fatalf("Source node (port %d) is not responding: %v", actualBasePort, err)
+	}
+
 	expectedPeers := actualNodeCount - 1
-	expected := *rounds / expectedPeers
+	fanout := status.Fanout
+	if fanout < 1 {
+		fanout = 1
+	}
+	if fanout > expectedPeers {
+		fanout = expectedPeers
+	}
+	expected := *rounds * fanout / expectedPeers
 
 	fmt.Printf("Parameters:\n")
 	fmt.Printf("  Rounds: %d\n", *rounds)
 	fmt.Printf("  Base Port: %d\n", actualBasePort)
 	fmt.Printf("  Nodes: %d\n", actualNodeCount)
+	fmt.Printf("  Fanout: %d\n", fanout)
+	fmt.Printf("  Peer Selection: %s\n", strategyName(status.PeerSelection))
 	fmt.Printf("  Expected per node: ~%d times (for %d peers)\n", expected, expectedPeers)
 	fmt.Printf("\n")
 
-	// Check if source node is healthy
-	if _, err := gossipClient.GetStatus(actualBasePort); err != nil {
-		log.Fatalf("Source node (port %d) is not responding: %v", actualBasePort, err)
-	}
-
 	fmt.Printf("Executing %d gossip rounds from node-0...\n", *rounds)
 
 	// Track targets
 	targetCounts := make(map[int]int)
+	sampling := samplingCheck{fanout: fanout}
 
 	// Execute gossip rounds
 	for i := 1; i <= *rounds; i++ {
 		trigger, err := gossipClient.TriggerGossip(actualBasePort)
 		if err != nil {
 			fmt.Print("!")
-		} else if trigger.Status == "sent" && trigger.Target != "" {
-			// Extract port number from target (localhost:18001 -> 18001)
-			parts := strings.Split(trigger.Target, ":")
-			if len(parts) == 2 {
+		} else if trigger.Status == "sent" && len(trigger.Targets) > 0 {
+			var nodeIDs []int
+			for _, target := range trigger.Targets {
+				// Extract port number from target (localhost:18001 -> 18001)
+				parts := strings.Split(target, ":")
+				if len(parts) != 2 {
+					continue
+				}
 				if targetPort, err := strconv.Atoi(parts[1]); err == nil {
 					nodeID := targetPort - actualBasePort
+					nodeIDs = append(nodeIDs, nodeID)
 					if nodeID >= 1 && nodeID < actualNodeCount {
 						targetCounts[nodeID]++
 					}
 				}
 			}
+			sampling.record(nodeIDs)
 			fmt.Print(".")
 		} else {
 			fmt.Print("!")
@@ -121,6 +138,63 @@ func main() {
 
 	// Analyze results
 	analyzeResults(targetCounts, actualNodeCount, *rounds, expected)
+	sampling.report()
+	fmt.Printf("Distribution produced by peer selection strategy: %s\n\n", strategyName(status.PeerSelection))
+}
+
+// strategyName falls back to uniform for nodes that predate pluggable selection
+func strategyName(name string) string {
+	if name == "" {
+		return "uniform"
+	}
+	return name
+}
+
+// samplingCheck verifies that each round's targets are sampled without
+// replacement: exactly fanout distinct peers, never the sender itself
+type samplingCheck struct {
+	fanout     int
+	rounds     int
+	duplicates int
+	self       int
+	wrongSize  int
+}
+
+func (c *samplingCheck) record(nodeIDs []int) {
+	c.rounds++
+	if len(nodeIDs) != c.fanout {
+		c.wrongSize++
+	}
+	seen := make(map[int]bool)
+	duplicate := false
+	for _, id := range nodeIDs {
+		if id == 0 {
+			c.self++
+		}
+		if seen[id] {
+			duplicate = true
+		}
+		seen[id] = true
+	}
+	if duplicate {
+		c.duplicates++
+	}
+}
+
+func (c *samplingCheck) report() {
+	fmt.Println("=== Sampling Check ===")
+	fmt.Printf("Rounds checked: %d (fanout %d)\n", c.rounds, c.fanout)
+	fmt.Printf("Rounds with duplicate targets: %d\n", c.duplicates)
+	fmt.Printf("Targets pointing at the sender: %d\n", c.self)
+	fmt.Printf("Rounds with unexpected target count: %d\n", c.wrongSize)
+
+	if c.duplicates == 0 && c.self == 0 && c.wrongSize == 0 {
+		fmt.Printf("%s✓ Targets sampled without replacement%s\n", colorGreen, colorReset)
+	} else {
+		fmt.Printf("%s✗ Sampling violated fanout without replacement%s\n", colorRed, colorReset)
+	}
+
+	fmt.Println()
 }
 
 func analyzeResults(targetCounts map[int]int, nodeCount, totalRounds, expected int) {
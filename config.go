@@ -0,0 +1,519 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// クラスター構成ファイル（--config）
+// ノード・アドレス・トポロジーの辺・ゴシップの設定・レート制限・障害注入をまとめてJSONで記述する
+// フラグの値を既定値として読み込むため、ファイルには変更したい項目だけを書けばよい
+//
+//	{
+//	  "nodes": [{"id": "a", "address": "localhost:18000"}, {"id": "b", "address": "localhost:18001", "faults": {"drop_rate": 0.2}}],
+//	  "topology": {"edges": [["a", "b"]]},
+//	  "gossip": {"mode": "pushpull", "interval": "500ms", "fanout": 2}
+//	}
+type ClusterFile struct {
+	BasePort  int `json:"base_port"`
+	AdminPort int `json:"admin_port"`
+	// nodesを指定した場合は無視する（ノード数はnodesの数）
+	NodeCount int        `json:"node_count"`
+	Nodes     []NodeFile `json:"nodes,omitempty"`
+
+	Topology        TopologyFile        `json:"topology"`
+	Gossip          GossipFile          `json:"gossip"`
+	RateLimit       RateLimitFile       `json:"rate_limit"`
+	PeerSampling    PeerSamplingFile    `json:"peer_sampling"`
+	FailureDetector FailureDetectorFile `json:"failure_detector"`
+	Faults          FaultFile           `json:"faults"`
+}
+
+// ノードごとの設定
+// IDを省略するとnode-番号、アドレスを省略するとlocalhost:base_port+番号になる
+// peersはIDかアドレスで指定し、topology.edgesと同じく無向辺として扱う
+type NodeFile struct {
+	ID      string     `json:"id,omitempty"`
+	Address string     `json:"address,omitempty"`
+	Peers   []string   `json:"peers,omitempty"`
+	Faults  *FaultFile `json:"faults,omitempty"`
+}
+
+// edges（ノードIDの組）かノードのpeersを指定した場合は、生成せずにその辺を使う（custom）
+type TopologyFile struct {
+	Name  string      `json:"name"`
+	K     int         `json:"k"`
+	P     float64     `json:"p"`
+	Seed  int64       `json:"seed"`
+	Edges [][2]string `json:"edges,omitempty"`
+}
+
+type GossipFile struct {
+	Mode           string   `json:"mode"`
+	Interval       Duration `json:"interval"`
+	Jitter         Duration `json:"jitter"`
+	Fanout         int      `json:"fanout"`
+	PeerSelection  string   `json:"peer_selection"`
+	Dissemination  string   `json:"dissemination"`
+	MaxDeltaKeys   int      `json:"delta_max_keys"`
+	MerkleDepth    int      `json:"merkle_depth"`
+	RumorVariant   string   `json:"rumor_variant"`
+	RumorK         int      `json:"rumor_k"`
+	VersionMode    string   `json:"version_mode"`
+	TombstoneGrace Duration `json:"tombstone_grace"`
+}
+
+type RateLimitFile struct {
+	Limit  int      `json:"limit"`
+	Period Duration `json:"period"`
+}
+
+type PeerSamplingFile struct {
+	Mode            string          `json:"mode"`
+	ViewSize        int             `json:"view_size"`
+	ShuffleLength   int             `json:"shuffle_length"`
+	ShuffleInterval Duration        `json:"shuffle_interval"`
+	HyParView       HyParViewConfig `json:"hyparview"`
+}
+
+type FailureDetectorFile struct {
+	Name string   `json:"name"`
+	Swim SwimFile `json:"swim"`
+	Phi  PhiFile  `json:"phi"`
+}
+
+type SwimFile struct {
+	Interval  Duration `json:"interval"`
+	Timeout   Duration `json:"timeout"`
+	K         int      `json:"k"`
+	Suspicion Duration `json:"suspicion"`
+}
+
+type PhiFile struct {
+	Threshold      float64  `json:"threshold"`
+	Window         int      `json:"window"`
+	MinStdDev      Duration `json:"min_stddev"`
+	FirstHeartbeat Duration `json:"first_heartbeat"`
+}
+
+type FaultFile struct {
+	DropRate float64  `json:"drop_rate"`
+	Delay    Duration `json:"delay"`
+}
+
+func (f FaultFile) config() FaultConfig {
+	return FaultConfig{DropRate: f.DropRate, Delay: time.Duration(f.Delay)}
+}
+
+func newFaultFile(config FaultConfig) FaultFile {
+	return FaultFile{DropRate: config.DropRate, Delay: Duration(config.Delay)}
+}
+
+// JSONでは"1s"や"200ms"のような文字列で表す時間
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1s\": %s", data)
+	}
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// 設定ファイルを解決した結果（起動するノードと適用するトポロジー）
+type clusterPlan struct {
+	Config         NodeConfig
+	TopologyConfig TopologyConfig
+	BasePort       int
+	AdminPort      int
+	Nodes          []NodeSpec
+	Topology       *Topology
+}
+
+// 起動するノード（Peersはトポロジーの隣接ノードのアドレス）
+type NodeSpec struct {
+	ID      string
+	Address string
+	Peers   []string
+	Faults  FaultConfig
+}
+
+func (p *clusterPlan) findSpec(id string) *NodeSpec {
+	for i := range p.Nodes {
+		if p.Nodes[i].ID == id {
+			return &p.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// フラグの値から設定ファイルの既定値を作る
+func newClusterFile(config NodeConfig, topologyConfig TopologyConfig, basePort, adminPort, nodeCount int) ClusterFile {
+	return ClusterFile{
+		BasePort:  basePort,
+		AdminPort: adminPort,
+		NodeCount: nodeCount,
+		Topology: TopologyFile{
+			Name: topologyConfig.Name,
+			K:    topologyConfig.K,
+			P:    topologyConfig.P,
+			Seed: topologyConfig.Seed,
+		},
+		Gossip: GossipFile{
+			Mode:           config.GossipMode,
+			Interval:       Duration(config.GossipInterval),
+			Jitter:         Duration(config.GossipJitter),
+			Fanout:         config.Fanout,
+			PeerSelection:  config.PeerSelection,
+			Dissemination:  config.Dissemination,
+			MaxDeltaKeys:   config.MaxDeltaKeys,
+			MerkleDepth:    config.MerkleDepth,
+			RumorVariant:   config.RumorVariant,
+			RumorK:         config.RumorK,
+			VersionMode:    config.VersionMode,
+			TombstoneGrace: Duration(config.TombstoneGrace),
+		},
+		RateLimit: RateLimitFile{Limit: config.GossipLimit, Period: Duration(config.LimitPeriod)},
+		PeerSampling: PeerSamplingFile{
+			Mode:            config.PeerSampling,
+			ViewSize:        config.ViewSize,
+			ShuffleLength:   config.ShuffleLength,
+			ShuffleInterval: Duration(config.ShuffleInterval),
+			HyParView:       config.HyParView,
+		},
+		FailureDetector: FailureDetectorFile{
+			Name: config.FailureDetector,
+			Swim: SwimFile{
+				Interval:  Duration(config.Swim.Interval),
+				Timeout:   Duration(config.Swim.Timeout),
+				K:         config.Swim.IndirectK,
+				Suspicion: Duration(config.Swim.SuspicionTimeout),
+			},
+			Phi: PhiFile{
+				Threshold:      config.Phi.Threshold,
+				Window:         config.Phi.WindowSize,
+				MinStdDev:      Duration(config.Phi.MinStdDev),
+				FirstHeartbeat: Duration(config.Phi.FirstHeartbeat),
+			},
+		},
+		Faults: newFaultFile(config.Faults),
+	}
+}
+
+// 設定ファイルを読み込み、fileの値を上書きする（ファイルにない項目はそのまま）
+// 未知の項目は書き間違いとみなしてエラーにする
+func loadClusterFile(path string, file *ClusterFile) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return decodeClusterFile(f, file)
+}
+
+func decodeClusterFile(r io.Reader, file *ClusterFile) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(file); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the config object")
+	}
+	return nil
+}
+
+func (f ClusterFile) nodeConfig() NodeConfig {
+	return NodeConfig{
+		GossipInterval:  time.Duration(f.Gossip.Interval),
+		GossipJitter:    time.Duration(f.Gossip.Jitter),
+		Fanout:          f.Gossip.Fanout,
+		PeerSelection:   f.Gossip.PeerSelection,
+		VersionMode:     f.Gossip.VersionMode,
+		GossipMode:      f.Gossip.Mode,
+		TombstoneGrace:  time.Duration(f.Gossip.TombstoneGrace),
+		Dissemination:   f.Gossip.Dissemination,
+		MaxDeltaKeys:    f.Gossip.MaxDeltaKeys,
+		MerkleDepth:     f.Gossip.MerkleDepth,
+		RumorVariant:    f.Gossip.RumorVariant,
+		RumorK:          f.Gossip.RumorK,
+		GossipLimit:     f.RateLimit.Limit,
+		LimitPeriod:     time.Duration(f.RateLimit.Period),
+		Topology:        f.Topology.Name,
+		PeerSampling:    f.PeerSampling.Mode,
+		ViewSize:        f.PeerSampling.ViewSize,
+		ShuffleLength:   f.PeerSampling.ShuffleLength,
+		ShuffleInterval: time.Duration(f.PeerSampling.ShuffleInterval),
+		HyParView:       f.PeerSampling.HyParView,
+		FailureDetector: f.FailureDetector.Name,
+		Swim: SwimConfig{
+			Interval:         time.Duration(f.FailureDetector.Swim.Interval),
+			Timeout:          time.Duration(f.FailureDetector.Swim.Timeout),
+			IndirectK:        f.FailureDetector.Swim.K,
+			SuspicionTimeout: time.Duration(f.FailureDetector.Swim.Suspicion),
+		},
+		Phi: PhiConfig{
+			Threshold:      f.FailureDetector.Phi.Threshold,
+			WindowSize:     f.FailureDetector.Phi.Window,
+			MinStdDev:      time.Duration(f.FailureDetector.Phi.MinStdDev),
+			FirstHeartbeat: time.Duration(f.FailureDetector.Phi.FirstHeartbeat),
+		},
+		Faults: f.Faults.config(),
+	}
+}
+
+// 設定を検証し、起動するノードとトポロジーを決める
+// topology.seedが0なら時刻から決める
+func (f ClusterFile) resolve() (*clusterPlan, error) {
+	config := f.nodeConfig()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if f.AdminPort < 0 || f.AdminPort > 65535 {
+		return nil, fmt.Errorf("invalid admin port: %d", f.AdminPort)
+	}
+
+	nodes, err := f.nodeSpecs(config.Faults)
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, node := range nodes {
+		index[node.ID] = i
+		index[node.Address] = i
+	}
+
+	topologyConfig := TopologyConfig{Name: f.Topology.Name, K: f.Topology.K, P: f.Topology.P, Seed: f.Topology.Seed}
+	if topologyConfig.Seed == 0 {
+		topologyConfig.Seed = time.Now().UnixNano()
+	}
+	custom := len(f.Topology.Edges) > 0
+	for _, node := range f.Nodes {
+		custom = custom || len(node.Peers) > 0
+	}
+
+	var topology *Topology
+	switch {
+	case config.PeerSampling == PeerSamplingHyParView:
+		// HyParViewはJOINでオーバーレイを作るため、辺は指定できない
+		if custom {
+			return nil, errors.New("hyparview builds its own overlay: topology edges and node peers are not allowed")
+		}
+		topology = &Topology{Name: PeerSamplingHyParView, Neighbors: make([][]int, len(nodes))}
+	case custom:
+		adjacency := make([]map[int]bool, len(nodes))
+		for i := range adjacency {
+			adjacency[i] = map[int]bool{}
+		}
+		connect := func(a, b string) error {
+			i, ok := index[a]
+			if !ok {
+				return fmt.Errorf("unknown node in topology: %s", a)
+			}
+			j, ok := index[b]
+			if !ok {
+				return fmt.Errorf("unknown node in topology: %s", b)
+			}
+			if i == j {
+				return fmt.Errorf("self loop on node %s", nodes[i].ID)
+			}
+			adjacency[i][j] = true
+			adjacency[j][i] = true
+			return nil
+		}
+		for _, edge := range f.Topology.Edges {
+			if err := connect(edge[0], edge[1]); err != nil {
+				return nil, err
+			}
+		}
+		for i, node := range f.Nodes {
+			for _, peer := range node.Peers {
+				if err := connect(nodes[i].ID, peer); err != nil {
+					return nil, err
+				}
+			}
+		}
+		topologyConfig = TopologyConfig{Name: TopologyCustom}
+		topology = topologyFromAdjacency(topologyConfig, adjacency)
+	case topologyConfig.Name == TopologyCustom:
+		return nil, errors.New("custom topology requires topology edges or node peers")
+	default:
+		topology, err = generateTopology(topologyConfig, len(nodes))
+		if err != nil {
+			return nil, err
+		}
+	}
+	config.Topology = topologyConfig.Name
+
+	for i := range nodes {
+		for _, j := range topology.Neighbors[i] {
+			nodes[i].Peers = append(nodes[i].Peers, nodes[j].Address)
+		}
+	}
+	return &clusterPlan{
+		Config:         config,
+		TopologyConfig: topologyConfig,
+		BasePort:       f.BasePort,
+		AdminPort:      f.AdminPort,
+		Nodes:          nodes,
+		Topology:       topology,
+	}, nil
+}
+
+// nodesがなければnode_count個のノードをbase_portから順に並べる
+func (f ClusterFile) nodeSpecs(faults FaultConfig) ([]NodeSpec, error) {
+	count := f.NodeCount
+	if len(f.Nodes) > 0 {
+		count = len(f.Nodes)
+	}
+	if count < 1 {
+		return nil, fmt.Errorf("node count must be at least 1: %d", count)
+	}
+
+	nodes := make([]NodeSpec, count)
+	seen := map[string]bool{}
+	for i := range nodes {
+		spec := NodeSpec{
+			ID:      fmt.Sprintf("node-%d", i),
+			Address: fmt.Sprintf("localhost:%d", f.BasePort+i),
+			Faults:  faults,
+		}
+		if i < len(f.Nodes) {
+			node := f.Nodes[i]
+			if node.ID != "" {
+				spec.ID = node.ID
+			}
+			if node.Address != "" {
+				spec.Address = node.Address
+			}
+			if node.Faults != nil {
+				spec.Faults = node.Faults.config()
+			}
+		}
+		if err := validAddress(spec.Address); err != nil {
+			return nil, fmt.Errorf("node %s: %w", spec.ID, err)
+		}
+		if spec.Faults.DropRate < 0 || spec.Faults.DropRate > 1 || spec.Faults.Delay < 0 {
+			return nil, fmt.Errorf("node %s: invalid fault injection: drop rate %g, delay %v", spec.ID, spec.Faults.DropRate, spec.Faults.Delay)
+		}
+		if seen[spec.ID] {
+			return nil, fmt.Errorf("duplicate node id: %s", spec.ID)
+		}
+		if seen[spec.Address] {
+			return nil, fmt.Errorf("duplicate node address: %s", spec.Address)
+		}
+		seen[spec.ID] = true
+		seen[spec.Address] = true
+		nodes[i] = spec
+	}
+	return nodes, nil
+}
+
+func validAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	if value, err := strconv.Atoi(port); err != nil || value < 1 || value > 65535 {
+		return fmt.Errorf("invalid port in address %q", address)
+	}
+	return nil
+}
+
+// 設定の検証結果（クラスターは起動しない）
+type ConfigValidation struct {
+	Valid     bool         `json:"valid"`
+	Error     string       `json:"error,omitempty"`
+	NodeCount int          `json:"node_count,omitempty"`
+	Topology  string       `json:"topology,omitempty"`
+	Edges     [][2]string  `json:"edges,omitempty"`
+	Connected bool         `json:"connected,omitempty"`
+	Config    *ClusterFile `json:"config,omitempty"`
+}
+
+// 設定を解決できるか確かめ、解決後の設定（生成したノードと辺を含む）を返す
+func validateClusterFile(file ClusterFile) ConfigValidation {
+	plan, err := file.resolve()
+	if err != nil {
+		return ConfigValidation{Error: err.Error()}
+	}
+	ids := make([]string, len(plan.Nodes))
+	for i, node := range plan.Nodes {
+		ids[i] = node.ID
+	}
+	resolved := plan.clusterFile(plan.Nodes, plan.Topology)
+	return ConfigValidation{
+		Valid:     true,
+		NodeCount: len(plan.Nodes),
+		Topology:  plan.Topology.Name,
+		Edges:     edgeIDs(plan.Topology, ids),
+		Connected: plan.Topology.Connected(),
+		Config:    &resolved,
+	}
+}
+
+// 実際に使う設定を設定ファイルの形式で表す
+// 生成したトポロジーは名前とシードで再現できるため、辺はcustomの場合だけ書き出す
+func (p *clusterPlan) clusterFile(nodes []NodeSpec, topology *Topology) ClusterFile {
+	file := newClusterFile(p.Config, p.TopologyConfig, p.BasePort, p.AdminPort, len(nodes))
+	for _, node := range nodes {
+		entry := NodeFile{ID: node.ID, Address: node.Address}
+		if node.Faults != p.Config.Faults {
+			faults := newFaultFile(node.Faults)
+			entry.Faults = &faults
+		}
+		file.Nodes = append(file.Nodes, entry)
+	}
+	if p.TopologyConfig.Name == TopologyCustom {
+		ids := make([]string, len(nodes))
+		for i, node := range nodes {
+			ids[i] = node.ID
+		}
+		file.Topology.Edges = edgeIDs(topology, ids)
+	}
+	return file
+}
+
+// トポロジーの辺をノードIDの組で表す
+func edgeIDs(topology *Topology, ids []string) [][2]string {
+	edges := [][2]string{}
+	for _, edge := range topology.Edges() {
+		if edge[0] < len(ids) && edge[1] < len(ids) {
+			edges = append(edges, [2]string{ids[edge[0]], ids[edge[1]]})
+		}
+	}
+	return edges
+}
+
+// POSTされた設定をdefaultsに重ねて検証する（クラスターは起動しない）
+func handleConfigValidation(w http.ResponseWriter, r *http.Request, defaults ClusterFile) {
+	file := defaults
+	validation := ConfigValidation{}
+	if err := decodeClusterFile(r.Body, &file); err != nil {
+		validation.Error = fmt.Sprintf("invalid config: %v", err)
+	} else {
+		validation = validateClusterFile(file)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !validation.Valid {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(validation)
+}
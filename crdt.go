@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// 状態型のインターフェース（docs/implementation-plan.md の State Interface）
+// Mergeは結合則・交換則・冪等性を満たし、受信順序に依らず収束する
+type State interface {
+	// 型名（ゴシップメッセージで状態を復元するために使用）
+	Type() string
+
+	// 状態のバージョン比較（レシーバがotherより新しい/古い/並行）
+	Compare(other State) (newer, older, conflict bool)
+
+	// 状態のマージ（レシーバは変更せず、新しい状態を返す）
+	Merge(other State) State
+
+	// シリアライゼーション
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+
+	// 状態の識別子（更新のたびに単調増加する）
+	Version() uint64
+
+	// 外部公開用の値
+	Value() interface{}
+}
+
+// 状態型のレジストリ
+var stateTypes = map[string]func() State{}
+
+// 状態型の登録（組み込み以外のCRDTを追加する拡張ポイント）
+func RegisterStateType(name string, factory func() State) {
+	stateTypes[name] = factory
+}
+
+func newState(typeName string) (State, error) {
+	factory, ok := stateTypes[typeName]
+	if !ok {
+		return nil, fmt.Errorf("unknown state type: %s", typeName)
+	}
+	return factory(), nil
+}
+
+const (
+	StateTypeGCounter    = "gcounter"
+	StateTypePNCounter   = "pncounter"
+	StateTypeORSet       = "orset"
+	StateTypeLWWRegister = "lwwregister"
+)
+
+func init() {
+	RegisterStateType(StateTypeGCounter, func() State { return NewGCounter() })
+	RegisterStateType(StateTypePNCounter, func() State { return NewPNCounter() })
+	RegisterStateType(StateTypeORSet, func() State { return NewORSet() })
+	RegisterStateType(StateTypeLWWRegister, func() State { return &LWWRegister{} })
+}
+
+// 要素ごとの大小関係から newer/older/conflict を求める
+func dominance(greater, less bool) (newer, older, conflict bool) {
+	return greater && !less, less && !greater, greater && less
+}
+
+// ---------------------------------------------------------------
+// G-Counter: ノードごとの増加量を保持する増加専用カウンタ
+
+type GCounter struct {
+	Counts map[string]uint64 `json:"counts"`
+}
+
+func NewGCounter() *GCounter {
+	return &GCounter{Counts: map[string]uint64{}}
+}
+
+func (c *GCounter) Type() string { return StateTypeGCounter }
+
+// nodeIDの担当分をdeltaだけ増やし、変更分のデルタ状態を返す
+func (c *GCounter) Increment(nodeID string, delta uint64) *GCounter {
+	c.Counts[nodeID] += delta
+	return &GCounter{Counts: map[string]uint64{nodeID: c.Counts[nodeID]}}
+}
+
+func (c *GCounter) Total() uint64 {
+	var total uint64
+	for _, count := range c.Counts {
+		total += count
+	}
+	return total
+}
+
+func (c *GCounter) Compare(other State) (newer, older, conflict bool) {
+	o, ok := other.(*GCounter)
+	if !ok {
+		return false, false, true
+	}
+	greater, less := c.compareCounts(o)
+	return dominance(greater, less)
+}
+
+func (c *GCounter) compareCounts(o *GCounter) (greater, less bool) {
+	for id, count := range c.Counts {
+		if count > o.Counts[id] {
+			greater = true
+		} else if count < o.Counts[id] {
+			less = true
+		}
+	}
+	for id, count := range o.Counts {
+		if _, ok := c.Counts[id]; !ok && count > 0 {
+			less = true
+		}
+	}
+	return greater, less
+}
+
+func (c *GCounter) Merge(other State) State {
+	merged := c.copy()
+	if o, ok := other.(*GCounter); ok {
+		for id, count := range o.Counts {
+			if count > merged.Counts[id] {
+				merged.Counts[id] = count
+			}
+		}
+	}
+	return merged
+}
+
+func (c *GCounter) copy() *GCounter {
+	dup := NewGCounter()
+	for id, count := range c.Counts {
+		dup.Counts[id] = count
+	}
+	return dup
+}
+
+func (c *GCounter) Marshal() ([]byte, error)    { return json.Marshal(c) }
+func (c *GCounter) Unmarshal(data []byte) error { return json.Unmarshal(data, c) }
+func (c *GCounter) Version() uint64             { return c.Total() }
+func (c *GCounter) Value() interface{}          { return c.Total() }
+
+// ---------------------------------------------------------------
+// PN-Counter: 増加用と減少用の2つのG-Counterで増減を表現する
+
+type PNCounter struct {
+	P *GCounter `json:"p"`
+	N *GCounter `json:"n"`
+}
+
+func NewPNCounter() *PNCounter {
+	return &PNCounter{P: NewGCounter(), N: NewGCounter()}
+}
+
+func (c *PNCounter) Type() string { return StateTypePNCounter }
+
+// deltaが負の場合は減少として記録し、変更分のデルタ状態を返す
+func (c *PNCounter) Add(nodeID string, delta int64) *PNCounter {
+	d := NewPNCounter()
+	if delta >= 0 {
+		d.P = c.P.Increment(nodeID, uint64(delta))
+	} else {
+		d.N = c.N.Increment(nodeID, uint64(-delta))
+	}
+	return d
+}
+
+func (c *PNCounter) Total() int64 {
+	return int64(c.P.Total()) - int64(c.N.Total())
+}
+
+func (c *PNCounter) Compare(other State) (newer, older, conflict bool) {
+	o, ok := other.(*PNCounter)
+	if !ok {
+		return false, false, true
+	}
+	pGreater, pLess := c.P.compareCounts(o.P)
+	nGreater, nLess := c.N.compareCounts(o.N)
+	return dominance(pGreater || nGreater, pLess || nLess)
+}
+
+func (c *PNCounter) Merge(other State) State {
+	o, ok := other.(*PNCounter)
+	if !ok {
+		return &PNCounter{P: c.P.copy(), N: c.N.copy()}
+	}
+	return &PNCounter{
+		P: c.P.Merge(o.P).(*GCounter),
+		N: c.N.Merge(o.N).(*GCounter),
+	}
+}
+
+func (c *PNCounter) Marshal() ([]byte, error) { return json.Marshal(c) }
+
+func (c *PNCounter) Unmarshal(data []byte) error {
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
+	}
+	if c.P == nil {
+		c.P = NewGCounter()
+	}
+	if c.N == nil {
+		c.N = NewGCounter()
+	}
+	return nil
+}
+
+func (c *PNCounter) Version() uint64    { return c.P.Total() + c.N.Total() }
+func (c *PNCounter) Value() interface{} { return c.Total() }
+
+// ---------------------------------------------------------------
+// OR-Set: 追加ごとに一意なタグを付け、削除は観測済みのタグのみを無効化する
+// 並行な追加と削除では追加が勝つ（add-wins）
+
+type ORSet struct {
+	Adds    map[string]map[string]bool `json:"adds"`    // 要素 -> タグ
+	Removed map[string]bool            `json:"removed"` // 削除済みタグ
+}
+
+func NewORSet() *ORSet {
+	return &ORSet{Adds: map[string]map[string]bool{}, Removed: map[string]bool{}}
+}
+
+func (s *ORSet) Type() string { return StateTypeORSet }
+
+// 一意なタグ付きで要素を追加し、変更分のデルタ状態を返す
+func (s *ORSet) Add(element, tag string) *ORSet {
+	if s.Adds[element] == nil {
+		s.Adds[element] = map[string]bool{}
+	}
+	s.Adds[element][tag] = true
+	return &ORSet{
+		Adds:    map[string]map[string]bool{element: {tag: true}},
+		Removed: map[string]bool{},
+	}
+}
+
+// 観測済みのタグをすべて削除済みにし、変更分のデルタ状態を返す
+// 要素が存在しなければfalse
+func (s *ORSet) Remove(element string) (*ORSet, bool) {
+	if !s.Contains(element) {
+		return nil, false
+	}
+	d := NewORSet()
+	for tag := range s.Adds[element] {
+		s.Removed[tag] = true
+		d.Removed[tag] = true
+	}
+	return d, true
+}
+
+func (s *ORSet) Contains(element string) bool {
+	for tag := range s.Adds[element] {
+		if !s.Removed[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// 現在の要素一覧（ソート済み）
+func (s *ORSet) Elements() []string {
+	elements := []string{}
+	for element := range s.Adds {
+		if s.Contains(element) {
+			elements = append(elements, element)
+		}
+	}
+	sort.Strings(elements)
+	return elements
+}
+
+func (s *ORSet) Compare(other State) (newer, older, conflict bool) {
+	o, ok := other.(*ORSet)
+	if !ok {
+		return false, false, true
+	}
+	greater := !s.subsetOf(o) // レシーバにだけあるタグがある
+	less := !o.subsetOf(s)    // otherにだけあるタグがある
+	return dominance(greater, less)
+}
+
+// レシーバのタグがすべてotherに含まれるか
+func (s *ORSet) subsetOf(o *ORSet) bool {
+	for element, tags := range s.Adds {
+		for tag := range tags {
+			if !o.Adds[element][tag] {
+				return false
+			}
+		}
+	}
+	for tag := range s.Removed {
+		if !o.Removed[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ORSet) Merge(other State) State {
+	merged := NewORSet()
+	for _, src := range []*ORSet{s, asORSet(other)} {
+		if src == nil {
+			continue
+		}
+		for element, tags := range src.Adds {
+			for tag := range tags {
+				merged.Add(element, tag)
+			}
+		}
+		for tag := range src.Removed {
+			merged.Removed[tag] = true
+		}
+	}
+	return merged
+}
+
+func asORSet(state State) *ORSet {
+	s, _ := state.(*ORSet)
+	return s
+}
+
+func (s *ORSet) Marshal() ([]byte, error) { return json.Marshal(s) }
+
+func (s *ORSet) Unmarshal(data []byte) error {
+	if err := json.Unmarshal(data, s); err != nil {
+		return err
+	}
+	if s.Adds == nil {
+		s.Adds = map[string]map[string]bool{}
+	}
+	if s.Removed == nil {
+		s.Removed = map[string]bool{}
+	}
+	return nil
+}
+
+func (s *ORSet) Version() uint64 {
+	var tags uint64
+	for _, t := range s.Adds {
+		tags += uint64(len(t))
+	}
+	return tags + uint64(len(s.Removed))
+}
+
+func (s *ORSet) Value() interface{} { return s.Elements() }
+
+// ---------------------------------------------------------------
+// LWW-Register: 論理バージョン（Lamportクロック + ノードID）の大きい書き込みが勝つ
+
+type LWWRegister struct {
+	Register string  `json:"value"`
+	Stamp    Version `json:"version"`
+}
+
+func (r *LWWRegister) Type() string { return StateTypeLWWRegister }
+
+func (r *LWWRegister) Set(value string, version Version) {
+	if version.NewerThan(r.Stamp) {
+		r.Register = value
+		r.Stamp = version
+	}
+}
+
+func (r *LWWRegister) Compare(other State) (newer, older, conflict bool) {
+	o, ok := other.(*LWWRegister)
+	if !ok {
+		return false, false, true
+	}
+	return r.Stamp.NewerThan(o.Stamp), o.Stamp.NewerThan(r.Stamp), false
+}
+
+func (r *LWWRegister) Merge(other State) State {
+	merged := &LWWRegister{Register: r.Register, Stamp: r.Stamp}
+	if o, ok := other.(*LWWRegister); ok {
+		merged.Set(o.Register, o.Stamp)
+	}
+	return merged
+}
+
+func (r *LWWRegister) Marshal() ([]byte, error)    { return json.Marshal(r) }
+func (r *LWWRegister) Unmarshal(data []byte) error { return json.Unmarshal(data, r) }
+func (r *LWWRegister) Version() uint64             { return r.Stamp.Clock }
+func (r *LWWRegister) Value() interface{}          { return r.Register }
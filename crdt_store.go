@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// ゴシップメッセージで運ばれるCRDT状態
+type StateEntry struct {
+	Key  string          `json:"key"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+var (
+	ErrStateTypeMismatch = errors.New("state type mismatch")
+	ErrElementNotFound   = errors.New("element not found")
+)
+
+// CRDT状態の外部公開用スナップショット
+type StateView struct {
+	Key     string      `json:"key"`
+	Type    string      `json:"type"`
+	Value   interface{} `json:"value"`
+	Version uint64      `json:"version"`
+}
+
+func viewOf(key string, state State) StateView {
+	return StateView{Key: key, Type: state.Type(), Value: state.Value(), Version: state.Version()}
+}
+
+// キーの状態をロック内で更新する
+// 未作成なら指定された型で作成し、既存の型と異なる場合はエラーとする
+// mutateは変更分のデルタ状態を返す（デルタ配信モードで使用）
+func (n *Node) updateState(key, typeName string, mutate func(State) (State, error)) (StateView, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	state, ok := n.States[key]
+	if !ok {
+		created, err := newState(typeName)
+		if err != nil {
+			return StateView{}, err
+		}
+		state = created
+	} else if state.Type() != typeName {
+		return StateView{}, fmt.Errorf("%w: key %q holds a %s, not a %s",
+			ErrStateTypeMismatch, key, state.Type(), typeName)
+	}
+
+	delta, err := mutate(state)
+	if err != nil {
+		return StateView{}, err
+	}
+	n.States[key] = state
+	n.recordStateDelta(key, delta)
+	n.updateMerkleState(key, state)
+	n.queueBroadcast(merkleStatePrefix + key)
+	n.markHotRumor(merkleStatePrefix + key)
+	n.LastSeen = time.Now().Unix()
+	log.Printf("[%s] State '%s' (%s) updated: %v", n.ID, key, typeName, state.Value())
+	return viewOf(key, state), nil
+}
+
+// カウンタの増減（G-Counterは負の値を受け付けない）
+func (n *Node) IncrementCounter(key, typeName string, delta int64) (StateView, error) {
+	return n.updateState(key, typeName, func(state State) (State, error) {
+		switch counter := state.(type) {
+		case *GCounter:
+			if delta < 0 {
+				return nil, fmt.Errorf("a %s cannot be decremented", StateTypeGCounter)
+			}
+			return counter.Increment(n.ID, uint64(delta)), nil
+		case *PNCounter:
+			return counter.Add(n.ID, delta), nil
+		default:
+			return nil, fmt.Errorf("%s is not a counter type", typeName)
+		}
+	})
+}
+
+// OR-Setへの要素追加（タグはノードID + Lamportクロックで一意にする）
+func (n *Node) AddToSet(key, element string) (StateView, error) {
+	return n.updateState(key, StateTypeORSet, func(state State) (State, error) {
+		n.Clock++
+		return state.(*ORSet).Add(element, fmt.Sprintf("%s:%d", n.ID, n.Clock)), nil
+	})
+}
+
+// OR-Setからの要素削除（観測済みの追加のみ取り消す）
+func (n *Node) RemoveFromSet(key, element string) (StateView, error) {
+	return n.updateState(key, StateTypeORSet, func(state State) (State, error) {
+		delta, ok := state.(*ORSet).Remove(element)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q not in set %q", ErrElementNotFound, element, key)
+		}
+		return delta, nil
+	})
+}
+
+// LWW-Registerへの書き込み（バージョンはKVストアと同じLamportクロック）
+func (n *Node) SetRegister(key, value string) (StateView, error) {
+	return n.updateState(key, StateTypeLWWRegister, func(state State) (State, error) {
+		n.Clock++
+		register := state.(*LWWRegister)
+		register.Set(value, Version{Clock: n.Clock, NodeID: n.ID})
+		return &LWWRegister{Register: register.Register, Stamp: register.Stamp}, nil
+	})
+}
+
+// thread-safeなCRDT状態の取得
+func (n *Node) GetState(key string) (StateView, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	state, ok := n.States[key]
+	if !ok {
+		return StateView{Key: key}, false
+	}
+	return viewOf(key, state), true
+}
+
+// 全CRDT状態のスナップショット（キー順）
+func (n *Node) StateViews() []StateView {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	views := make([]StateView, 0, len(n.States))
+	for key, state := range n.States {
+		views = append(views, viewOf(key, state))
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Key < views[j].Key })
+	return views
+}
+
+// ゴシップ送信用に全CRDT状態をシリアライズする
+func (n *Node) StateEntries() []StateEntry {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	entries := make([]StateEntry, 0, len(n.States))
+	for key, state := range n.States {
+		entry, err := encodeStateEntry(key, state)
+		if err != nil {
+			log.Printf("[%s] Failed to marshal state '%s': %v", n.ID, key, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+func encodeStateEntry(key string, state State) (StateEntry, error) {
+	data, err := state.Marshal()
+	if err != nil {
+		return StateEntry{}, err
+	}
+	return StateEntry{Key: key, Type: state.Type(), Data: data}, nil
+}
+
+func decodeStateEntry(entry StateEntry) (State, error) {
+	state, err := newState(entry.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := state.Unmarshal(entry.Data); err != nil {
+		return nil, fmt.Errorf("failed to decode %s '%s': %v", entry.Type, entry.Key, err)
+	}
+	return state, nil
+}
+
+// リモートから届いたCRDT状態のマージ
+// 手元が同じか新しい場合は何もせず、状態が変化したかを返す
+func (n *Node) MergeStateEntry(entry StateEntry) (bool, error) {
+	remote, err := decodeStateEntry(entry)
+	if err != nil {
+		return false, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.mergeStateLocked(entry.Key, remote)
+}
+
+// 呼び出し側でロックを保持していること
+func (n *Node) mergeStateLocked(key string, remote State) (bool, error) {
+	if stamp, ok := remote.(*LWWRegister); ok {
+		n.observeClock(stamp.Stamp.Clock)
+	}
+
+	local, ok := n.States[key]
+	if !ok {
+		n.States[key] = remote
+		n.recordStateDelta(key, remote)
+		n.updateMerkleState(key, remote)
+		n.markHotRumor(merkleStatePrefix + key)
+		log.Printf("[%s] State '%s' (%s) created: %v", n.ID, key, remote.Type(), remote.Value())
+		return true, nil
+	}
+	if local.Type() != remote.Type() {
+		return false, fmt.Errorf("%w for '%s': local %s, remote %s",
+			ErrStateTypeMismatch, key, local.Type(), remote.Type())
+	}
+
+	_, older, conflict := local.Compare(remote)
+	if !older && !conflict {
+		return false, nil
+	}
+	merged := local.Merge(remote)
+	n.States[key] = merged
+	n.recordStateDelta(key, remote)
+	n.updateMerkleState(key, merged)
+	n.markHotRumor(merkleStatePrefix + key)
+	n.LastSeen = time.Now().Unix()
+	log.Printf("[%s] State '%s' (%s) merged: %v -> %v", n.ID, key, merged.Type(), local.Value(), merged.Value())
+	return true, nil
+}
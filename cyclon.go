@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// ピアサンプリング方式
+const (
+	// 起動時のピアリストをそのまま使う
+	PeerSamplingStatic = "static"
+	// Cyclonの部分ビューを定期的にシャッフルする
+	PeerSamplingCyclon = "cyclon"
+)
+
+// 部分ビューの1エントリ（Ageはシャッフルのたびに増え、最も古い相手とシャッフルする）
+type ViewEntry struct {
+	Address string `json:"address"`
+	Age     int    `json:"age"`
+}
+
+// シャッフル要求（能動側が送るエントリには自分自身がAge 0で含まれる）
+type ShuffleRequest struct {
+	From    string      `json:"from"`
+	Entries []ViewEntry `json:"entries"`
+}
+
+// シャッフル応答（受動側のビューからランダムに選んだエントリ）
+type ShuffleResponse struct {
+	Entries []ViewEntry `json:"entries"`
+}
+
+// 起動時のピアからViewSize個をランダムに選んで初期ビューとする
+func (n *Node) initView() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.view = nil
+	for _, index := range rand.Perm(len(n.Peers)) {
+		if len(n.view) == n.ViewSize {
+			break
+		}
+		n.view = append(n.view, ViewEntry{Address: n.Peers[index]})
+	}
+}
+
+// ゴシップ送信先の候補（cyclonなら部分ビュー、それ以外は静的ピア）
+func (n *Node) gossipCandidates() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.gossipCandidatesLocked()
+}
+
+// 呼び出し側でロックを保持していること
+func (n *Node) gossipCandidatesLocked() []string {
+	if n.PeerSampling != PeerSamplingCyclon {
+		return append([]string(nil), n.Peers...)
+	}
+	candidates := make([]string, len(n.view))
+	for i, entry := range n.view {
+		candidates[i] = entry.Address
+	}
+	return candidates
+}
+
+// 現在のビュー（staticの場合は静的ピアをAge 0として返す）
+func (n *Node) View() []ViewEntry {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.PeerSampling != PeerSamplingCyclon {
+		view := make([]ViewEntry, len(n.Peers))
+		for i, peer := range n.Peers {
+			view[i] = ViewEntry{Address: peer}
+		}
+		return view
+	}
+	return append([]ViewEntry{}, n.view...)
+}
+
+// Cyclonのシャッフル（能動側）
+// 1. 全エントリのAgeを1増やし、最も古いエントリQを選んでビューから外す
+// 2. 残りからShuffleLength-1個と自分自身（Age 0）をQへ送る
+// 3. Qの応答をビューへ取り込む（Qが応答しなければ外したままにして故障ノードを除去する）
+func (n *Node) Shuffle() (string, error) {
+	n.mu.Lock()
+	if len(n.view) == 0 {
+		n.mu.Unlock()
+		// 全エントリが故障で外れた場合は起動時のピアから選び直す
+		n.initView()
+		return "", fmt.Errorf("view is empty, reseeded from bootstrap peers")
+	}
+	oldest := 0
+	for i := range n.view {
+		n.view[i].Age++
+		if n.view[i].Age > n.view[oldest].Age {
+			oldest = i
+		}
+	}
+	target := n.view[oldest].Address
+	n.view = append(n.view[:oldest], n.view[oldest+1:]...)
+	sent := append(randomViewSubset(n.view, n.ShuffleLength-1), ViewEntry{Address: n.Address})
+	n.mu.Unlock()
+
+	var response ShuffleResponse
+	request := ShuffleRequest{From: n.Address, Entries: sent}
+	if _, err := n.postJSON(target, "/shuffle", request, &response); err != nil {
+		return target, err
+	}
+
+	n.mu.Lock()
+	n.mergeViewLocked(response.Entries, sent)
+	n.mu.Unlock()
+	return target, nil
+}
+
+// シャッフル要求を受け取り（受動側）、自分のビューの一部を返す
+func (n *Node) HandleShuffle(request ShuffleRequest) ShuffleResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	reply := randomViewSubset(n.view, n.ShuffleLength)
+	n.mergeViewLocked(request.Entries, reply)
+	return ShuffleResponse{Entries: reply}
+}
+
+// 受け取ったエントリをビューへ取り込む（呼び出し側でロックを保持していること）
+// 自分自身と既にビューにあるアドレスは捨て、空きスロットを先に埋め、
+// 空きがなければ相手へ送ったエントリと置き換える
+func (n *Node) mergeViewLocked(received, sent []ViewEntry) {
+	for _, entry := range received {
+		if entry.Address == n.Address || viewIndex(n.view, entry.Address) >= 0 {
+			continue
+		}
+		if len(n.view) < n.ViewSize {
+			n.view = append(n.view, entry)
+			continue
+		}
+		for len(sent) > 0 {
+			i := viewIndex(n.view, sent[0].Address)
+			sent = sent[1:]
+			if i >= 0 {
+				n.view[i] = entry
+				break
+			}
+		}
+	}
+}
+
+func viewIndex(view []ViewEntry, address string) int {
+	for i, entry := range view {
+		if entry.Address == address {
+			return i
+		}
+	}
+	return -1
+}
+
+// ビューからk個のエントリをランダムに選ぶ（コピーを返す）
+func randomViewSubset(view []ViewEntry, k int) []ViewEntry {
+	if k > len(view) {
+		k = len(view)
+	}
+	subset := make([]ViewEntry, 0, k)
+	for _, index := range rand.Perm(len(view))[:k] {
+		subset = append(subset, view[index])
+	}
+	return subset
+}
+
+// 定期シャッフルループ（cyclon/hyparviewの場合のみ）
+func (n *Node) StartShuffleLoop() {
+	if n.PeerSampling == PeerSamplingStatic || n.ShuffleInterval <= 0 {
+		return
+	}
+	shuffle := n.Shuffle
+	if n.PeerSampling == PeerSamplingHyParView {
+		shuffle = n.hyParViewShuffle
+	}
+
+	n.spawn(func() {
+		// ノード間でシャッフルのタイミングが揃わないよう初回をずらす
+		if !n.sleep(time.Duration(rand.Int63n(int64(n.ShuffleInterval)))) {
+			return
+		}
+		ticker := time.NewTicker(n.ShuffleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-n.quit:
+				return
+			case <-ticker.C:
+			}
+			if n.HasLeft() {
+				continue
+			}
+			if target, err := shuffle(); err != nil {
+				log.Printf("[%s] Shuffle with %s failed: %v", n.ID, target, err)
+			}
+		}
+	})
+}
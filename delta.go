@@ -0,0 +1,218 @@
+package main
+
+// 状態の配信モード
+const (
+	DisseminationFull  = "full"  // 毎回全状態を送信
+	DisseminationDelta = "delta" // 前回の交換以降の差分のみ送信
+)
+
+// ピアごとに蓄積する、前回の交換以降の差分
+type deltaBuffer struct {
+	entries  map[string]bool  // 変更されたKVキー（送信時に最新のエントリを載せる）
+	states   map[string]State // 結合済みのCRDTデルタ状態
+	synced   bool             // 一度でも全状態を送ったか
+	overflow bool             // 上限を超えた（全状態へフォールバックする）
+}
+
+func newDeltaBuffer() *deltaBuffer {
+	return &deltaBuffer{entries: map[string]bool{}, states: map[string]State{}}
+}
+
+func (b *deltaBuffer) size() int {
+	return len(b.entries) + len(b.states)
+}
+
+// 呼び出し側でロックを保持していること
+func (n *Node) deltaBufferFor(peer string) *deltaBuffer {
+	buf, ok := n.deltaBuffers[peer]
+	if !ok {
+		buf = newDeltaBuffer()
+		n.deltaBuffers[peer] = buf
+	}
+	return buf
+}
+
+// 現在のゴシップ送信先候補のバッファ（cyclonでは部分ビューのメンバー）
+// 候補から外れたピアのバッファは捨てる。外れている間の差分を持たないため、
+// 候補に戻ったときは未同期として全状態から送り直す
+// 呼び出し側でロックを保持していること
+func (n *Node) candidateDeltaBuffersLocked() []*deltaBuffer {
+	candidates := n.gossipCandidatesLocked()
+	for peer := range n.deltaBuffers {
+		if !containsString(candidates, peer) {
+			delete(n.deltaBuffers, peer)
+		}
+	}
+	buffers := make([]*deltaBuffer, len(candidates))
+	for i, peer := range candidates {
+		buffers[i] = n.deltaBufferFor(peer)
+	}
+	return buffers
+}
+
+// KVキーの変更を送信先候補のバッファに記録する
+// 呼び出し側でロックを保持していること
+func (n *Node) recordEntryDelta(key string) {
+	if n.Dissemination != DisseminationDelta {
+		return
+	}
+	for _, buf := range n.candidateDeltaBuffersLocked() {
+		if buf.overflow {
+			continue
+		}
+		buf.entries[key] = true
+		n.checkDeltaOverflow(buf)
+	}
+}
+
+// CRDTのデルタ状態を送信先候補のバッファへ結合する
+// 呼び出し側でロックを保持していること
+func (n *Node) recordStateDelta(key string, delta State) {
+	if n.Dissemination != DisseminationDelta || delta == nil {
+		return
+	}
+	for _, buf := range n.candidateDeltaBuffersLocked() {
+		if buf.overflow {
+			continue
+		}
+		if pending, ok := buf.states[key]; ok && pending.Type() == delta.Type() {
+			buf.states[key] = pending.Merge(delta)
+		} else {
+			buf.states[key] = delta
+		}
+		n.checkDeltaOverflow(buf)
+	}
+}
+
+// 差分が大きくなりすぎたピアは、次回全状態を送る
+func (n *Node) checkDeltaOverflow(buf *deltaBuffer) {
+	if n.MaxDeltaKeys > 0 && buf.size() > n.MaxDeltaKeys {
+		buf.overflow = true
+		buf.entries = map[string]bool{}
+		buf.states = map[string]State{}
+	}
+}
+
+// 送信先に応じたゴシップメッセージの組み立て
+// デルタモードでは送信分のバッファを取り出して返す（送信失敗時はrestoreDeltaで戻す）
+func (n *Node) buildGossipMessage(target string) (GossipMessage, *deltaBuffer) {
+	n.mu.Lock()
+	var taken *deltaBuffer
+	if n.Dissemination == DisseminationDelta {
+		buf := n.deltaBufferFor(target)
+		if buf.synced && !buf.overflow {
+			taken = buf
+			fresh := newDeltaBuffer()
+			fresh.synced = true
+			n.deltaBuffers[target] = fresh
+		} else {
+			// これから送る全状態が、ここまでの差分をすべて含む
+			buf.overflow = false
+			buf.entries = map[string]bool{}
+			buf.states = map[string]State{}
+		}
+	}
+
+	if taken == nil {
+		n.mu.Unlock()
+		return GossipMessage{From: n.ID, Entries: n.Entries(), States: n.StateEntries()}, nil
+	}
+
+	msg := GossipMessage{From: n.ID, Delta: true, Entries: []Entry{}}
+	for key := range taken.entries {
+		if entry, ok := n.Store[key]; ok {
+			msg.Entries = append(msg.Entries, entry.copy())
+		}
+	}
+	for key, delta := range taken.states {
+		if entry, err := encodeStateEntry(key, delta); err == nil {
+			msg.States = append(msg.States, entry)
+		}
+	}
+	n.mu.Unlock()
+	return msg, taken
+}
+
+// 送信結果に応じたバッファの更新
+// 成功時は全状態を送った場合に同期済みとし、失敗時は取り出した差分を戻す
+func (n *Node) completeDelta(target string, msg GossipMessage, taken *deltaBuffer, sent bool) {
+	if n.Dissemination != DisseminationDelta {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	buf := n.deltaBufferFor(target)
+	if sent {
+		if !msg.Delta {
+			// 全状態の組み立て後に記録された差分は残したまま同期済みにする
+			buf.synced = true
+		}
+		return
+	}
+	if taken == nil {
+		return
+	}
+	for key := range taken.entries {
+		buf.entries[key] = true
+	}
+	for key, delta := range taken.states {
+		if pending, ok := buf.states[key]; ok && pending.Type() == delta.Type() {
+			buf.states[key] = pending.Merge(delta)
+		} else {
+			buf.states[key] = delta
+		}
+	}
+	n.checkDeltaOverflow(buf)
+}
+
+// 送信メッセージの種別
+const (
+	trafficFull   = "full"
+	trafficDelta  = "delta"
+	trafficDigest = "digest"
+)
+
+// 送受信したゴシップメッセージの量（全状態とデルタの帯域比較用）
+type TrafficStats struct {
+	MessagesSentFull   int64 `json:"messages_sent_full"`
+	MessagesSentDelta  int64 `json:"messages_sent_delta"`
+	MessagesSentDigest int64 `json:"messages_sent_digest"`
+	BytesSentFull      int64 `json:"bytes_sent_full"`
+	BytesSentDelta     int64 `json:"bytes_sent_delta"`
+	BytesSentDigest    int64 `json:"bytes_sent_digest"`
+	MessagesReceived   int64 `json:"messages_received"`
+	BytesReceived      int64 `json:"bytes_received"`
+	LastMessageBytes   int   `json:"last_message_bytes"`
+}
+
+func (n *Node) recordSent(bytes int, kind string) {
+	n.trafficMu.Lock()
+	defer n.trafficMu.Unlock()
+	switch kind {
+	case trafficDelta:
+		n.traffic.MessagesSentDelta++
+		n.traffic.BytesSentDelta += int64(bytes)
+	case trafficDigest:
+		n.traffic.MessagesSentDigest++
+		n.traffic.BytesSentDigest += int64(bytes)
+	default:
+		n.traffic.MessagesSentFull++
+		n.traffic.BytesSentFull += int64(bytes)
+	}
+	n.traffic.LastMessageBytes = bytes
+}
+
+func (n *Node) recordReceived(bytes int) {
+	n.trafficMu.Lock()
+	defer n.trafficMu.Unlock()
+	n.traffic.MessagesReceived++
+	n.traffic.BytesReceived += int64(bytes)
+}
+
+// 送受信量のスナップショット
+func (n *Node) Traffic() TrafficStats {
+	n.trafficMu.Lock()
+	defer n.trafficMu.Unlock()
+	return n.traffic
+}
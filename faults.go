@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+var ErrInjectedDrop = errors.New("message dropped by fault injection")
+
+// 送信側での障害注入（実験用）
+//   - DropRate: 送信メッセージを送らずに失敗させる確率（0〜1）
+//   - Delay: 送信前に挟む遅延（ネットワーク遅延の模擬）
+type FaultConfig struct {
+	DropRate float64
+	Delay    time.Duration
+}
+
+func (f FaultConfig) Enabled() bool {
+	return f.DropRate > 0 || f.Delay > 0
+}
+
+// 送信の直前に呼び、遅延を挟んでから、落とす場合はErrInjectedDropを返す
+func (n *Node) injectFault() error {
+	// 遅延中に停止が始まったら、StopとWaitが遅延の終わりを待たないよう送らずに返す
+	if n.faults.Delay > 0 && !n.sleep(n.faults.Delay) {
+		return ErrNodeStopping
+	}
+	if n.faults.DropRate > 0 && rand.Float64() < n.faults.DropRate {
+		n.faultDrops.Add(1)
+		return ErrInjectedDrop
+	}
+	return nil
+}
+
+// JSON出力用の障害注入の設定と、落としたメッセージ数
+type FaultStatus struct {
+	DropRate float64 `json:"drop_rate"`
+	DelayMs  int64   `json:"delay_ms"`
+	Dropped  int64   `json:"dropped"`
+}
+
+func (n *Node) FaultStatus() FaultStatus {
+	return FaultStatus{
+		DropRate: n.faults.DropRate,
+		DelayMs:  n.faults.Delay.Milliseconds(),
+		Dropped:  n.faultDrops.Load(),
+	}
+}
@@ -2,79 +2,293 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
 type GossipMessage struct {
-	From      string `json:"from"`
-	Value     string `json:"value"`
-	Timestamp int64  `json:"timestamp"`
+	From      string       `json:"from"`
+	Entries   []Entry      `json:"entries"`
+	States    []StateEntry `json:"states,omitempty"`
+	Timestamp int64        `json:"timestamp"`
+
+	// 前回の交換以降の差分のみを含む場合true
+	Delta bool `json:"delta,omitempty"`
+
+	// rumor mongeringのメッセージ（受信側は既知のキーを応答する）
+	Rumor bool `json:"rumor,omitempty"`
+
+	// recursive gossipの木の根と、根からのホップ数（受信側は木の子へ転送する）
+	TreeRoot string `json:"tree_root,omitempty"`
+	TreeHops int    `json:"tree_hops,omitempty"`
+
+	// SWIMのメンバー状態の更新（相乗り）
+	Members []MemberUpdate `json:"members,omitempty"`
+
+	// 参加・離脱のメンバーシップリスト（相乗り）
+	Membership []MemberRecord `json:"membership,omitempty"`
 }
 
-// ★ ゴシップの本質：ランダム選択
-func (n *Node) selectRandomPeer() string {
-	n.mu.RLock()
-	defer n.mu.RUnlock()
+// 1回の送信で一部またはすべての送信先が失敗したことを表す
+// Targetsは送信を試みた全送信先、Failedは失敗した送信先とそのエラー
+type SendError struct {
+	Targets []string
+	Failed  map[string]error
+}
 
-	if len(n.Peers) == 0 {
-		return ""
+// errs[i]はtargets[i]への送信結果（すべて成功ならnilを返す）
+func newSendError(targets []string, errs []error) error {
+	failed := map[string]error{}
+	for i, err := range errs {
+		if err != nil {
+			failed[targets[i]] = err
+		}
 	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &SendError{Targets: targets, Failed: failed}
+}
 
-	index := rand.Intn(len(n.Peers))
-	return n.Peers[index]
+func (e *SendError) Error() string {
+	var parts []string
+	for _, target := range e.Targets {
+		if err, ok := e.Failed[target]; ok {
+			parts = append(parts, fmt.Sprintf("%s: %v", target, err))
+		}
+	}
+	return fmt.Sprintf("failed to send to %d of %d targets: %s", len(e.Failed), len(e.Targets), strings.Join(parts, "; "))
+}
+
+func (e *SendError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, target := range e.Targets {
+		if err, ok := e.Failed[target]; ok {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// すべての送信先が失敗したか
+func (e *SendError) AllFailed() bool {
+	return len(e.Failed) == len(e.Targets)
+}
+
+// /triggerの応答に含める送信先ごとの結果
+type TriggerResult struct {
+	Target string `json:"target"`
+	Status string `json:"status"` // sent または failed
+	Error  string `json:"error,omitempty"`
+}
+
+// 送信先ごとの結果（errがSendErrorでなければ全送信先を成功とする）
+func triggerResults(targets []string, err error) []TriggerResult {
+	var sendErr *SendError
+	errors.As(err, &sendErr)
+	results := make([]TriggerResult, len(targets))
+	for i, target := range targets {
+		results[i] = TriggerResult{Target: target, Status: "sent"}
+		if sendErr != nil {
+			if failure, ok := sendErr.Failed[target]; ok {
+				results[i] = TriggerResult{Target: target, Status: "failed", Error: failure.Error()}
+			}
+		}
+	}
+	return results
+}
+
+// ★ ゴシップの本質：ランダム選択
+// k個の異なるピアをピア選択戦略に従って選ぶ（ピア数がk未満なら全ピア）
+func (n *Node) selectPeers(k int) []string {
+	// SWIMでdeadと判定されたピアには送らない
+	var peers []string
+	for _, peer := range n.gossipCandidates() {
+		if !n.isDead(peer) {
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) == 0 {
+		return nil
+	}
+	return n.selector.Select(peers, k)
 }
 
 // ゴシップ送信実行
-func (n *Node) SendGossip() (string, error) {
-	target := n.selectRandomPeer()
-	if target == "" {
-		return "", fmt.Errorf("no peers available")
+// fanout個のピアへ並列に送信し、送信先の一覧を返す
+// 送信方式はゴシップモード（push/pushpull/merkle/rumor）に従う
+// rumorモードで拡散中のrumorも確認待ちのtombstoneもない場合は何も送らず空のターゲットを返す
+func (n *Node) SendGossip() ([]string, error) {
+	if n.HasLeft() {
+		return nil, ErrNodeLeft
+	}
+	mode := n.GetGossipMode()
+	if mode == GossipModeRumor && !n.HasHotRumors() && !n.hasUnackedTombstones() {
+		return nil, nil
+	}
+	// plumtreeは全域木に沿って配信するため、ピア選択とfanoutを使わない
+	if mode == GossipModePlumtree {
+		if !n.hasPendingBroadcasts() {
+			return nil, nil
+		}
+		if !n.limiter.Take() {
+			return nil, ErrRateLimited
+		}
+		return n.plumtreeRound()
 	}
 
-	message := GossipMessage{
-		From:      n.ID,
-		Value:     n.GetValue(),
-		Timestamp: time.Now().Unix(),
+	peers := n.selectPeers(n.Fanout)
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peers available")
 	}
 
-	err := n.sendHTTPMessage(target, message)
-	if err != nil {
-		return target, fmt.Errorf("failed to send to %s: %v", target, err)
+	// トークンが残っている分だけ送る（1送信先につき1トークン）
+	var targets []string
+	for _, peer := range peers {
+		if !n.limiter.Take() {
+			break
+		}
+		targets = append(targets, peer)
+	}
+	if len(targets) == 0 {
+		return nil, ErrRateLimited
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(targets))
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			start := time.Now()
+			errs[i] = n.gossipTo(mode, target)
+			n.selector.Observe(target, time.Since(start), errs[i])
+			if errs[i] != nil {
+				n.handlePeerFailure(target)
+			}
+		}(i, target)
 	}
+	wg.Wait()
 
-	log.Printf("[%s] Sent gossip to %s: value='%s'", n.ID, target, message.Value)
-	return target, nil
+	return targets, newSendError(targets, errs)
+}
+
+// 1つのピアとゴシップモードに応じた交換を行う
+func (n *Node) gossipTo(mode, target string) error {
+	switch mode {
+	case GossipModePushPull:
+		return n.pushPullGossip(target)
+	case GossipModeMerkle:
+		return n.merkleGossip(target)
+	case GossipModeRumor:
+		return n.rumorGossip(target)
+	default:
+		return n.pushGossip(target)
+	}
 }
 
-// HTTP経由でメッセージ送信
-func (n *Node) sendHTTPMessage(targetAddr string, msg GossipMessage) error {
-	jsonData, err := json.Marshal(msg)
+// push型: 自分の状態（または差分）を一方的に送る
+func (n *Node) pushGossip(target string) error {
+	message, taken := n.buildGossipMessage(target)
+	message.Timestamp = time.Now().Unix()
+
+	size, err := n.sendHTTPMessage(target, message)
+	n.completeDelta(target, message, taken, err == nil)
 	if err != nil {
 		return err
 	}
 
-	url := fmt.Sprintf("http://%s/gossip", targetAddr)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	kind := trafficFull
+	if message.Delta {
+		kind = trafficDelta
+	}
+	n.recordSent(size, kind)
+	n.recordTombstoneAcks(target, message.Entries)
+
+	log.Printf("[%s] Sent %s gossip to %s: %d entries, %d states (%d bytes)",
+		n.ID, kind, target, len(message.Entries), len(message.States), size)
+	return nil
+}
+
+// HTTP経由でメッセージ送信（送信したバイト数を返す）
+func (n *Node) sendHTTPMessage(targetAddr string, msg GossipMessage) (int, error) {
+	msg.Members = n.swimPiggyback()
+	msg.Membership = n.Membership()
+	return n.postJSON(targetAddr, "/gossip", msg, nil)
+}
+
+// JSONをPOSTし、応答をresponseにデコードする（responseがnilなら読み捨て）
+// 送信したバイト数を返す（Stopは送信中のリクエストの完了を待つ）
+func (n *Node) postJSON(targetAddr, path string, request, response interface{}) (int, error) {
+	if err := n.injectFault(); err != nil {
+		return 0, err
+	}
+	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	url := fmt.Sprintf("http://%s%s", targetAddr, path)
+	ctx, cancel := context.WithTimeout(n.ctx, peerRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error: %s", resp.Status)
+		return 0, fmt.Errorf("HTTP error: %s", resp.Status)
 	}
 
-	return nil
+	if response != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			return len(jsonData), fmt.Errorf("invalid response: %v", err)
+		}
+	}
+
+	return len(jsonData), nil
 }
 
 // ゴシップメッセージ受信処理
-func (n *Node) HandleGossipMessage(msg GossipMessage) {
-	log.Printf("[%s] Received gossip from %s: value='%s'",
-		n.ID, msg.From, msg.Value)
-	n.SetValue(msg.Value)
+// rumorメッセージの場合は、既に知っていた（状態が変化しなかった）キーを応答に含める
+func (n *Node) HandleGossipMessage(msg GossipMessage) GossipAck {
+	n.applyMemberUpdates(msg.Members)
+	n.MergeMembership(msg.Membership, "")
+	n.recordHeartbeat(msg.From)
+	ack := GossipAck{Status: "received"}
+	updated := 0
+	for _, entry := range msg.Entries {
+		if n.MergeEntry(entry) {
+			updated++
+		} else if msg.Rumor {
+			ack.Known = append(ack.Known, merkleEntryPrefix+entry.Key)
+		}
+	}
+	for _, state := range msg.States {
+		changed, err := n.MergeStateEntry(state)
+		if err != nil {
+			log.Printf("[%s] Rejected state '%s' from %s: %v", n.ID, state.Key, msg.From, err)
+		} else if changed {
+			updated++
+		} else if msg.Rumor {
+			ack.Known = append(ack.Known, merkleStatePrefix+state.Key)
+		}
+	}
+	log.Printf("[%s] Received gossip from %s: %d entries, %d states (%d updated)",
+		n.ID, msg.From, len(msg.Entries), len(msg.States), updated)
+	n.forwardTreeMessage(msg)
+	return ack
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"time"
+)
+
+// 定期ゴシップループ（Riakのgossip_intervalタイマーに相当）
+// GossipIntervalが0以下の場合はループを起動しない（手動トリガーのみ）
+func (n *Node) StartGossipLoop() {
+	if n.GossipInterval <= 0 {
+		return
+	}
+
+	log.Printf("[%s] Gossip loop started: interval=%s jitter=%s",
+		n.ID, n.GossipInterval, n.GossipJitter)
+
+	n.spawn(func() {
+		// 起動直後の同期を避けるため、初回は0〜intervalのランダムな遅延
+		timer := time.NewTimer(time.Duration(rand.Int63n(int64(n.GossipInterval))))
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-n.quit:
+				return
+			case <-timer.C:
+			}
+			if !n.IsPaused() && !n.HasLeft() {
+				if _, err := n.SendGossip(); err != nil {
+					log.Printf("[%s] Periodic gossip failed: %v", n.ID, err)
+				}
+			}
+			timer.Reset(n.nextGossipDelay())
+		}
+	})
+}
+
+// 次回ゴシップまでの待ち時間（interval + 0〜jitterのランダム値）
+func (n *Node) nextGossipDelay() time.Duration {
+	delay := n.GossipInterval
+	if n.GossipJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(n.GossipJitter)))
+	}
+	return delay
+}
+
+// 定期ゴシップの一時停止
+func (n *Node) Pause() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.paused {
+		log.Printf("[%s] Gossip loop paused", n.ID)
+		n.paused = true
+	}
+}
+
+// 定期ゴシップの再開
+func (n *Node) Resume() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.paused {
+		log.Printf("[%s] Gossip loop resumed", n.ID)
+		n.paused = false
+	}
+}
+
+// 一時停止中かどうか
+func (n *Node) IsPaused() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.paused
+}
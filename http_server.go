@@ -2,11 +2,14 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 )
 
-func startHTTPServer(node *Node) {
+// ノードのエンドポイント
+func newNodeMux(node *Node) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// ゴシップメッセージ受信エンドポイント
@@ -16,35 +19,268 @@ func startHTTPServer(node *Node) {
 			return
 		}
 
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+
 		var msg GossipMessage
-		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		if err := json.Unmarshal(body, &msg); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
 
 		// ゴシップ処理
-		node.HandleGossipMessage(msg)
+		node.recordReceived(len(body))
+		ack := node.HandleGossipMessage(msg)
 
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "received"})
+		json.NewEncoder(w).Encode(ack)
 	})
 
-	// 手動ゴシップトリガー
-	mux.HandleFunc("/trigger", func(w http.ResponseWriter, r *http.Request) {
+	// anti-entropy: ダイジェストを受け取り、差分を返す
+	mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		var digest Digest
+		if err := json.Unmarshal(body, &digest); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		node.recordReceived(len(body))
+		json.NewEncoder(w).Encode(node.HandleDigest(digest))
+	})
+
+	// Merkle木: GETで根ハッシュ、POSTで部分木ハッシュ・葉の項目を問い合わせ
+	mux.HandleFunc("/merkle", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"root": node.MerkleRoot(),
+			})
+		case http.MethodPost:
+			var request MerkleRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(node.HandleMerkleRequest(request))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Cyclonのシャッフル（受け取ったエントリを取り込み、自分のビューの一部を返す）
+	mux.HandleFunc("/shuffle", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request ShuffleRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(node.HandleShuffle(request))
+	})
+
+	// Plumtreeのメッセージ（GOSSIP/IHAVE/PRUNE/GRAFT）
+	mux.HandleFunc("/plumtree", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		var message PlumtreeMessage
+		if err := json.Unmarshal(body, &message); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		node.recordReceived(len(body))
+		json.NewEncoder(w).Encode(node.HandlePlumtree(message))
+	})
+
+	// SWIMのPING/PING_REQ
+	mux.HandleFunc("/swim", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !node.swimEnabled() {
+			http.Error(w, "failure detector disabled", http.StatusNotFound)
+			return
+		}
+
+		var message SwimMessage
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(node.HandleSwim(message))
+	})
+
+	// HyParViewのメンバーシップメッセージ
+	mux.HandleFunc("/hyparview", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var message HyParViewMessage
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(node.HandleHyParView(message))
+	})
+
+	// メンバーシップリストの取得（GET）と交換（POST: 相手のリストを取り込み自分のリストを返す）
+	mux.HandleFunc("/membership", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(MembershipMessage{From: node.Address, Members: node.Membership()})
+		case http.MethodPost:
+			var message MembershipMessage
+			if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(node.HandleMembership(message))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// seed経由でクラスターへ参加（離脱後の再参加も可）
+	mux.HandleFunc("/join", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		target, err := node.SendGossip()
+		seed := r.URL.Query().Get("seed")
+		if seed == "" {
+			http.Error(w, "seed parameter is required", http.StatusBadRequest)
+			return
+		}
+		if err := node.JoinCluster(seed); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "joined",
+			"seed":   seed,
+			"peers":  node.gossipCandidates(),
+		})
+	})
+
+	// 状態を引き継いでからクラスターを離脱
+	// ノード自体は停止せず、/joinで再参加できるようHTTPサーバーは動かし続ける
+	// 離脱中はピアを持たず、定期ゴシップ・シャッフル・故障検出は何も送らない
+	// ノードを止める場合は管理APIのDELETE /nodes/{id}（single modeではプロセスの終了）を使う
+	mux.HandleFunc("/leave", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		result, err := node.Leave()
+		if errors.Is(err, ErrNodeLeft) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "left",
+			"handoff_to": result.HandoffTo,
+			"notified":   result.Notified,
+		})
+	})
 
-		response := map[string]string{
-			"status": "sent",
-			"target": target,
+	// 手動ゴシップトリガー
+	// mode=random（既定）/recursive/random-recursive
+	mux.HandleFunc("/trigger", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = TriggerRandom
+		}
+
+		var targets []string
+		var err error
+		switch mode {
+		case TriggerRandom:
+			targets, err = node.SendGossip()
+		case TriggerRecursive:
+			targets, err = node.RecursiveGossip()
+		case TriggerRandomRecursive:
+			targets, err = node.RandomRecursiveGossip()
+		default:
+			http.Error(w, "unknown trigger mode: "+mode, http.StatusBadRequest)
+			return
+		}
+
+		// 一部の送信先だけが失敗した場合は、送信できた分があるため200で送信先ごとの結果を返す
+		var sendErr *SendError
+		partial := errors.As(err, &sendErr) && !sendErr.AllFailed()
+		if !partial {
+			if errors.Is(err, ErrRateLimited) {
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+			if errors.Is(err, ErrNodeLeft) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		}
+
+		// rumorモードで拡散中のrumorがない場合などは送信しない
+		status := "sent"
+		switch {
+		case partial:
+			status = "partial"
+		case err != nil:
+			status = "failed"
+		case len(targets) == 0:
+			status = "idle"
+		}
+		response := map[string]interface{}{
+			"status":  status,
+			"mode":    mode,
+			"targets": targets,
+			"results": triggerResults(targets, err),
+		}
+		if err != nil {
+			response["error"] = err.Error()
+		}
+		if status == "failed" {
+			w.WriteHeader(http.StatusInternalServerError)
 		}
 		json.NewEncoder(w).Encode(response)
 	})
@@ -73,11 +309,286 @@ func startHTTPServer(node *Node) {
 			return
 		}
 
-		node.SetValue(value)
-		json.NewEncoder(w).Encode(map[string]string{"status": "updated", "value": value})
+		// vclockモード: /status で取得したcontextを渡すと、読んだsiblingを置き換える
+		var context VectorClock
+		if encoded := r.URL.Query().Get("context"); encoded != "" {
+			decoded, err := DecodeContext(encoded)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			context = decoded
+		}
+
+		// キー未指定時はデフォルトキー（単一値時代との互換）
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			key = DefaultKey
+		}
+
+		version := node.Set(key, value, context)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "updated",
+			"key":     key,
+			"value":   value,
+			"version": version,
+		})
 	})
 
-	// サーバー起動
-	log.Printf("[%s] HTTP server starting on %s", node.ID, node.Address)
-	log.Fatal(http.ListenAndServe(node.Address, mux))
+	// キー取得エンドポイント
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key parameter required", http.StatusBadRequest)
+			return
+		}
+
+		entry, ok := node.Get(key)
+		if !ok {
+			http.Error(w, "key not found", http.StatusNotFound)
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":     entry.Key,
+			"value":   entry.Value,
+			"version": entry.Version,
+		}
+		if node.VersionMode == VersionModeVClock {
+			response["siblings"] = entry.Siblings
+			response["context"] = EncodeContext(siblingsContext(entry.Siblings))
+		}
+		json.NewEncoder(w).Encode(response)
+	})
+
+	// キー削除エンドポイント
+	mux.HandleFunc("/delete", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key parameter required", http.StatusBadRequest)
+			return
+		}
+
+		if !node.Delete(key) {
+			http.Error(w, "key not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "key": key})
+	})
+
+	// キー一覧エンドポイント
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": node.Keys()})
+	})
+
+	// ゴシップモードの確認・変更（push/pushpull/merkle/rumor）
+	mux.HandleFunc("/mode", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if err := node.SetGossipMode(r.URL.Query().Get("mode")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"gossip_mode": node.GetGossipMode()})
+	})
+
+	// 定期ゴシップの一時停止
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		node.Pause()
+		json.NewEncoder(w).Encode(map[string]string{"status": "paused"})
+	})
+
+	// 定期ゴシップの再開
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		node.Resume()
+		json.NewEncoder(w).Encode(map[string]string{"status": "resumed"})
+	})
+
+	registerCRDTHandlers(mux, node)
+	return mux
+}
+
+// CRDT操作エンドポイント
+func registerCRDTHandlers(mux *http.ServeMux, node *Node) {
+	// カウンタの増加（type=pncounter|gcounter、既定はpncounter）
+	mux.HandleFunc("/counter/incr", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key, by, ok := counterParams(w, r)
+		if !ok {
+			return
+		}
+		typeName := r.URL.Query().Get("type")
+		if typeName == "" {
+			typeName = StateTypePNCounter
+		}
+
+		view, err := node.IncrementCounter(key, typeName, by)
+		writeStateResult(w, view, err)
+	})
+
+	// カウンタの減少（PN-Counterのみ）
+	mux.HandleFunc("/counter/decr", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key, by, ok := counterParams(w, r)
+		if !ok {
+			return
+		}
+
+		view, err := node.IncrementCounter(key, StateTypePNCounter, -by)
+		writeStateResult(w, view, err)
+	})
+
+	// OR-Setへの要素追加
+	mux.HandleFunc("/set/add", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key, element := r.URL.Query().Get("key"), r.URL.Query().Get("element")
+		if key == "" || element == "" {
+			http.Error(w, "key and element parameters required", http.StatusBadRequest)
+			return
+		}
+
+		view, err := node.AddToSet(key, element)
+		writeStateResult(w, view, err)
+	})
+
+	// OR-Setからの要素削除
+	mux.HandleFunc("/set/remove", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key, element := r.URL.Query().Get("key"), r.URL.Query().Get("element")
+		if key == "" || element == "" {
+			http.Error(w, "key and element parameters required", http.StatusBadRequest)
+			return
+		}
+
+		view, err := node.RemoveFromSet(key, element)
+		writeStateResult(w, view, err)
+	})
+
+	// LWW-Registerへの書き込み
+	mux.HandleFunc("/register/set", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key, value := r.URL.Query().Get("key"), r.URL.Query().Get("value")
+		if key == "" || value == "" {
+			http.Error(w, "key and value parameters required", http.StatusBadRequest)
+			return
+		}
+
+		view, err := node.SetRegister(key, value)
+		writeStateResult(w, view, err)
+	})
+
+	// CRDT状態の取得（型を問わない）
+	mux.HandleFunc("/crdt", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key parameter required", http.StatusBadRequest)
+			return
+		}
+
+		view, ok := node.GetState(key)
+		if !ok {
+			http.Error(w, "key not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(view)
+	})
+
+	// CRDT状態の一覧
+	mux.HandleFunc("/crdts", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"states": node.StateViews()})
+	})
+}
+
+// key と by（省略時は1）パラメータの取得
+func counterParams(w http.ResponseWriter, r *http.Request) (string, int64, bool) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key parameter required", http.StatusBadRequest)
+		return "", 0, false
+	}
+
+	by := int64(1)
+	if s := r.URL.Query().Get("by"); s != "" {
+		parsed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "by must be a positive integer", http.StatusBadRequest)
+			return "", 0, false
+		}
+		by = parsed
+	}
+	return key, by, true
+}
+
+func writeStateResult(w http.ResponseWriter, view StateView, err error) {
+	switch {
+	case errors.Is(err, ErrStateTypeMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrElementNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		json.NewEncoder(w).Encode(view)
+	}
 }
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// HyParView: 小さなアクティブビュー（= Peers、ゴシップの送信先）と
+// 大きなパッシブビュー（故障時の補充候補）を持つメンバーシップオーバーレイ
+const PeerSamplingHyParView = "hyparview"
+
+// HyParViewのメッセージ種別
+const (
+	HyParViewJoin         = "JOIN"
+	HyParViewForwardJoin  = "FORWARD_JOIN"
+	HyParViewNeighbor     = "NEIGHBOR"
+	HyParViewDisconnect   = "DISCONNECT"
+	HyParViewShuffle      = "SHUFFLE"
+	HyParViewShuffleReply = "SHUFFLE_REPLY"
+)
+
+// JOINの再試行（コンタクトノードの起動待ち）
+const (
+	joinAttempts = 20
+	joinBackoff  = 100 * time.Millisecond
+)
+
+// HyParViewのパラメータ
+//   - ARWL: FORWARD_JOIN/SHUFFLEのランダムウォーク長
+//   - PRWL: FORWARD_JOINの参加ノードをパッシブビューへ入れるTTL
+//   - ShuffleActive/ShufflePassive: SHUFFLEで送るアクティブ/パッシブビューのエントリ数
+type HyParViewConfig struct {
+	ActiveSize     int `json:"active_size"`
+	PassiveSize    int `json:"passive_size"`
+	ARWL           int `json:"arwl"`
+	PRWL           int `json:"prwl"`
+	ShuffleActive  int `json:"shuffle_active"`
+	ShufflePassive int `json:"shuffle_passive"`
+}
+
+type HyParViewMessage struct {
+	Type string `json:"type"`
+	// 直前の送信者
+	From string `json:"from"`
+	// JOIN/SHUFFLEの発信元（転送されても変わらない）
+	Origin       string   `json:"origin,omitempty"`
+	TTL          int      `json:"ttl,omitempty"`
+	HighPriority bool     `json:"high_priority,omitempty"`
+	Nodes        []string `json:"nodes,omitempty"`
+}
+
+// JOIN/NEIGHBORを受け入れたかどうか
+type HyParViewReply struct {
+	Accepted bool `json:"accepted"`
+}
+
+func (n *Node) sendHyParView(target string, message HyParViewMessage) (HyParViewReply, error) {
+	var reply HyParViewReply
+	_, err := n.postJSON(target, "/hyparview", message, &reply)
+	return reply, err
+}
+
+// 非同期に送り、失敗した送信先はアクティブビューから外す
+func (n *Node) sendHyParViewAsync(target string, message HyParViewMessage) {
+	n.spawn(func() {
+		if _, err := n.sendHyParView(target, message); err != nil {
+			log.Printf("[%s] HyParView %s to %s failed: %v", n.ID, message.Type, target, err)
+			n.handlePeerFailure(target)
+		}
+	})
+}
+
+// コンタクトノードへJOINし、受け入れられたらアクティブビューへ加える
+func (n *Node) Join(contact string) error {
+	var err error
+	for attempt := 0; attempt < joinAttempts; attempt++ {
+		var reply HyParViewReply
+		reply, err = n.sendHyParView(contact, HyParViewMessage{Type: HyParViewJoin, From: n.Address})
+		if err == nil && reply.Accepted {
+			n.addActive(contact)
+			log.Printf("[%s] Joined overlay via %s", n.ID, contact)
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("join rejected by %s", contact)
+		}
+		if !n.sleep(joinBackoff) {
+			break
+		}
+	}
+	return err
+}
+
+// HyParViewメッセージ受信処理
+func (n *Node) HandleHyParView(message HyParViewMessage) HyParViewReply {
+	switch message.Type {
+	case HyParViewJoin:
+		n.addActive(message.From)
+		for _, peer := range n.activeExcept(message.From) {
+			n.sendHyParViewAsync(peer, HyParViewMessage{
+				Type:   HyParViewForwardJoin,
+				From:   n.Address,
+				Origin: message.From,
+				TTL:    n.HyParView.ARWL,
+			})
+		}
+		return HyParViewReply{Accepted: true}
+
+	case HyParViewForwardJoin:
+		n.handleForwardJoin(message)
+		return HyParViewReply{Accepted: true}
+
+	case HyParViewNeighbor:
+		n.mu.Lock()
+		accept := message.HighPriority || len(n.Peers) < n.HyParView.ActiveSize || containsString(n.Peers, message.From)
+		n.mu.Unlock()
+		if accept {
+			n.addActive(message.From)
+		}
+		return HyParViewReply{Accepted: accept}
+
+	case HyParViewDisconnect:
+		n.mu.Lock()
+		if n.removeActiveLocked(message.From) {
+			n.addPassiveLocked(message.From, nil)
+		}
+		n.mu.Unlock()
+		return HyParViewReply{Accepted: true}
+
+	case HyParViewShuffle:
+		n.handleShuffleWalk(message)
+		return HyParViewReply{Accepted: true}
+
+	case HyParViewShuffleReply:
+		n.mu.Lock()
+		for _, node := range message.Nodes {
+			n.addPassiveLocked(node, n.lastShuffle)
+		}
+		n.mu.Unlock()
+		return HyParViewReply{Accepted: true}
+	}
+	return HyParViewReply{}
+}
+
+// FORWARD_JOIN: TTLが尽きるか転送先がなければ参加ノードをアクティブビューへ加え、
+// TTLがPRWLに達したらパッシブビューへ加えて、ランダムウォークを続ける
+func (n *Node) handleForwardJoin(message HyParViewMessage) {
+	origin := message.Origin
+	if origin == n.Address {
+		return
+	}
+
+	candidates := n.activeExcept(message.From, origin)
+	if message.TTL <= 0 || len(candidates) == 0 {
+		n.addActive(origin)
+		// 参加ノード側にも自分をアクティブビューへ入れてもらう
+		n.sendHyParViewAsync(origin, HyParViewMessage{Type: HyParViewNeighbor, From: n.Address, HighPriority: true})
+		return
+	}
+	if message.TTL == n.HyParView.PRWL {
+		n.mu.Lock()
+		n.addPassiveLocked(origin, nil)
+		n.mu.Unlock()
+	}
+
+	next := candidates[rand.Intn(len(candidates))]
+	n.sendHyParViewAsync(next, HyParViewMessage{
+		Type:   HyParViewForwardJoin,
+		From:   n.Address,
+		Origin: origin,
+		TTL:    message.TTL - 1,
+	})
+}
+
+// SHUFFLE: ランダムウォークの終点で、受け取ったエントリをパッシブビューへ取り込み、
+// 同数のパッシブビューのエントリを発信元へ返す
+func (n *Node) handleShuffleWalk(message HyParViewMessage) {
+	if message.Origin == n.Address {
+		return
+	}
+	candidates := n.activeExcept(message.From, message.Origin)
+	if message.TTL-1 > 0 && len(candidates) > 0 {
+		next := candidates[rand.Intn(len(candidates))]
+		forward := message
+		forward.From = n.Address
+		forward.TTL--
+		n.sendHyParViewAsync(next, forward)
+		return
+	}
+
+	n.mu.Lock()
+	reply := randomSubset(n.passive, len(message.Nodes))
+	for _, node := range message.Nodes {
+		n.addPassiveLocked(node, reply)
+	}
+	n.mu.Unlock()
+
+	// 発信元とはアクティブな接続がないことがあるため、失敗してもビューは変更しない
+	n.spawn(func() {
+		n.sendHyParView(message.Origin, HyParViewMessage{Type: HyParViewShuffleReply, From: n.Address, Nodes: reply})
+	})
+}
+
+// 定期SHUFFLE: 自分自身とアクティブ/パッシブビューの一部をランダムウォークで送る
+// アクティブビューが不足していればパッシブビューから補充する
+func (n *Node) hyParViewShuffle() (string, error) {
+	if n.activeCount() < n.HyParView.ActiveSize {
+		n.repairActive()
+	}
+
+	n.mu.Lock()
+	if len(n.Peers) == 0 {
+		n.mu.Unlock()
+		return "", fmt.Errorf("active view is empty")
+	}
+	target := n.Peers[rand.Intn(len(n.Peers))]
+	nodes := append([]string{n.Address}, randomSubset(n.Peers, n.HyParView.ShuffleActive)...)
+	nodes = append(nodes, randomSubset(n.passive, n.HyParView.ShufflePassive)...)
+	n.lastShuffle = nodes
+	n.mu.Unlock()
+
+	_, err := n.sendHyParView(target, HyParViewMessage{
+		Type:   HyParViewShuffle,
+		From:   n.Address,
+		Origin: n.Address,
+		TTL:    n.HyParView.ARWL,
+		Nodes:  nodes,
+	})
+	if err != nil {
+		n.handlePeerFailure(target)
+	}
+	return target, err
+}
+
+// アクティブビューの故障ノードを外し、パッシブビューから補充する
+func (n *Node) handlePeerFailure(peer string) {
+	if n.PeerSampling != PeerSamplingHyParView {
+		return
+	}
+	n.mu.Lock()
+	removed := n.removeActiveLocked(peer)
+	n.mu.Unlock()
+	if removed {
+		log.Printf("[%s] Removed failed peer %s from active view", n.ID, peer)
+		n.repairActive()
+	}
+}
+
+// パッシブビューのノードへNEIGHBORを送り、アクティブビューを満たす
+// アクティブビューが空なら高優先度（相手は必ず受け入れる）で送る
+// 応答しないノードはパッシブビューからも外し、拒否したノードは残す
+func (n *Node) repairActive() {
+	tried := map[string]bool{}
+	for {
+		n.mu.Lock()
+		if len(n.Peers) >= n.HyParView.ActiveSize {
+			n.mu.Unlock()
+			return
+		}
+		var candidates []string
+		for _, peer := range n.passive {
+			if !tried[peer] {
+				candidates = append(candidates, peer)
+			}
+		}
+		highPriority := len(n.Peers) == 0
+		n.mu.Unlock()
+		if len(candidates) == 0 {
+			return
+		}
+
+		candidate := candidates[rand.Intn(len(candidates))]
+		tried[candidate] = true
+		reply, err := n.sendHyParView(candidate, HyParViewMessage{Type: HyParViewNeighbor, From: n.Address, HighPriority: highPriority})
+		if err != nil {
+			n.mu.Lock()
+			n.passive = removeString(n.passive, candidate)
+			n.mu.Unlock()
+			continue
+		}
+		if reply.Accepted {
+			n.addActive(candidate)
+		}
+	}
+}
+
+// アクティブビューへ加える（満杯ならランダムに1つ外してDISCONNECTを送る）
+func (n *Node) addActive(peer string) {
+	n.mu.Lock()
+	if peer == n.Address || containsString(n.Peers, peer) {
+		n.mu.Unlock()
+		return
+	}
+	dropped := ""
+	if len(n.Peers) >= n.HyParView.ActiveSize {
+		dropped = n.Peers[rand.Intn(len(n.Peers))]
+		n.removeActiveLocked(dropped)
+		n.addPassiveLocked(dropped, nil)
+	}
+	n.passive = removeString(n.passive, peer)
+	n.Peers = append(n.Peers, peer)
+	n.mu.Unlock()
+
+	if dropped != "" {
+		n.spawn(func() {
+			n.sendHyParView(dropped, HyParViewMessage{Type: HyParViewDisconnect, From: n.Address})
+		})
+	}
+}
+
+// 呼び出し側でロックを保持していること
+func (n *Node) removeActiveLocked(peer string) bool {
+	if !containsString(n.Peers, peer) {
+		return false
+	}
+	n.Peers = removeString(n.Peers, peer)
+	return true
+}
+
+// パッシブビューへ加える（呼び出し側でロックを保持していること）
+// 満杯なら、preferに含まれるエントリ（交換で相手へ渡したもの）を優先して外す
+func (n *Node) addPassiveLocked(peer string, prefer []string) {
+	if peer == n.Address || containsString(n.Peers, peer) || containsString(n.passive, peer) {
+		return
+	}
+	if len(n.passive) >= n.HyParView.PassiveSize {
+		evict := ""
+		for _, candidate := range prefer {
+			if containsString(n.passive, candidate) {
+				evict = candidate
+				break
+			}
+		}
+		if evict == "" {
+			evict = n.passive[rand.Intn(len(n.passive))]
+		}
+		n.passive = removeString(n.passive, evict)
+	}
+	n.passive = append(n.passive, peer)
+}
+
+func (n *Node) activeCount() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.Peers)
+}
+
+// 指定したノードを除くアクティブビュー
+func (n *Node) activeExcept(excluded ...string) []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var peers []string
+	for _, peer := range n.Peers {
+		if !containsString(excluded, peer) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// アクティブビューとパッシブビュー
+func (n *Node) HyParViewViews() ([]string, []string) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return append([]string{}, n.Peers...), append([]string{}, n.passive...)
+}
+
+func removeString(list []string, value string) []string {
+	result := list[:0:0]
+	for _, item := range list {
+		if item != value {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// リストからk個をランダムに選ぶ（コピーを返す）
+func randomSubset(list []string, k int) []string {
+	if k > len(list) {
+		k = len(list)
+	}
+	subset := make([]string, 0, k)
+	for _, index := range rand.Perm(len(list))[:k] {
+		subset = append(subset, list[index])
+	}
+	return subset
+}
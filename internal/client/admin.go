@@ -1,9 +1,11 @@
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -14,16 +16,136 @@ type ClusterInfo struct {
 	AdminPort int    `json:"admin_port"`
 	Topology  string `json:"topology"`
 	StartedAt int64  `json:"started_at"`
+
+	PeerSelection string `json:"peer_selection"`
+	Fanout        int    `json:"fanout"`
+
+	TopologyK    int      `json:"topology_k,omitempty"`
+	TopologyP    float64  `json:"topology_p,omitempty"`
+	TopologySeed int64    `json:"topology_seed"`
+	Connected    bool     `json:"connected"`
+	Edges        [][2]int `json:"edges"`
+
+	// Members lists the nodes currently joined; NodeCount is its length
+	Members []MemberRecord `json:"members"`
+
+	// Config is the effective cluster config in the --config file format
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// ConfigValidation is the admin API's verdict on a cluster config file
+type ConfigValidation struct {
+	Valid     bool            `json:"valid"`
+	Error     string          `json:"error,omitempty"`
+	NodeCount int             `json:"node_count,omitempty"`
+	Topology  string          `json:"topology,omitempty"`
+	Edges     [][2]string     `json:"edges,omitempty"`
+	Connected bool            `json:"connected,omitempty"`
+	Config    json.RawMessage `json:"config,omitempty"`
 }
 
 // NodeInfo represents node information from admin API
 type NodeInfo struct {
-	ID        string `json:"id"`
-	Port      int    `json:"port"`
+	ID         string  `json:"id"`
+	Port       int     `json:"port"`
+	Address    string  `json:"address"`
+	Value      string  `json:"value"`
+	Version    Version `json:"version"`
+	KeyCount   int     `json:"key_count"`
+	Tombstones int     `json:"tombstones"`
+	PeerCount  int     `json:"peer_count"`
+	LastSeen   int64   `json:"last_seen"`
+}
+
+// NodeView is a node's current peer sampling view
+type NodeView struct {
+	ID      string      `json:"id"`
+	Address string      `json:"address"`
+	View    []ViewEntry `json:"view"`
+}
+
+// ViewReport summarizes the overlay formed by all partial views
+type ViewReport struct {
+	PeerSampling string         `json:"peer_sampling"`
+	Nodes        []NodeView     `json:"nodes"`
+	InDegree     map[string]int `json:"in_degree"`
+	Distribution map[int]int    `json:"in_degree_distribution"`
+	MinInDegree  int            `json:"min_in_degree"`
+	MaxInDegree  int            `json:"max_in_degree"`
+	MeanInDegree float64        `json:"mean_in_degree"`
+	Connected    bool           `json:"connected"`
+}
+
+// HyParViewInfo lists a node's HyParView active and passive views
+type HyParViewInfo struct {
+	ID      string   `json:"id"`
+	Address string   `json:"address"`
+	Active  []string `json:"active"`
+	Passive []string `json:"passive"`
+}
+
+// HyParViewReport is the admin view of the HyParView overlay
+type HyParViewReport struct {
+	Nodes           []HyParViewInfo `json:"nodes"`
+	AsymmetricLinks int             `json:"asymmetric_links"`
+	ActiveConnected bool            `json:"active_connected"`
+	PeerSampling    string          `json:"peer_sampling"`
+}
+
+// PlumtreeStats are a node's Plumtree message counters
+type PlumtreeStats struct {
+	GossipSent     int64 `json:"gossip_sent"`
+	GossipReceived int64 `json:"gossip_received"`
+	Redundant      int64 `json:"redundant"`
+	IHaveSent      int64 `json:"ihave_sent"`
+	PruneSent      int64 `json:"prune_sent"`
+	GraftSent      int64 `json:"graft_sent"`
+}
+
+// PlumtreeNodeInfo is a node's Plumtree eager/lazy peers and counters
+type PlumtreeNodeInfo struct {
+	ID      string        `json:"id"`
+	Address string        `json:"address"`
+	Eager   []string      `json:"eager"`
+	Lazy    []string      `json:"lazy"`
+	Stats   PlumtreeStats `json:"stats"`
+}
+
+// PlumtreeReport is the Plumtree spanning tree and cluster-wide message counts
+type PlumtreeReport struct {
+	Nodes          []PlumtreeNodeInfo `json:"nodes"`
+	TreeEdges      [][2]string        `json:"tree_edges"`
+	GossipSent     int64              `json:"gossip_sent"`
+	Redundant      int64              `json:"redundant"`
+	IHaveSent      int64              `json:"ihave_sent"`
+	GraftSent      int64              `json:"graft_sent"`
+	PruneSent      int64              `json:"prune_sent"`
+	TrafficSent    int64              `json:"traffic_messages_sent"`
+	RedundancyRate float64            `json:"redundancy_rate"`
+}
+
+// LivenessSummary counts how many nodes see a member in each SWIM state
+type LivenessSummary struct {
 	Address   string `json:"address"`
-	Value     string `json:"value"`
-	PeerCount int    `json:"peer_count"`
-	LastSeen  int64  `json:"last_seen"`
+	Alive     int    `json:"alive"`
+	Suspect   int    `json:"suspect"`
+	Dead      int    `json:"dead"`
+	Consensus string `json:"consensus"`
+}
+
+// LivenessReport aggregates every node's SWIM member view
+type LivenessReport struct {
+	FailureDetector string                       `json:"failure_detector"`
+	Views           map[string]map[string]string `json:"views"`
+	Members         []LivenessSummary            `json:"members"`
+}
+
+// PhiReport is the cluster-wide phi matrix: observer node -> peer -> phi
+type PhiReport struct {
+	FailureDetector string                        `json:"failure_detector"`
+	Threshold       float64                       `json:"threshold"`
+	Matrix          map[string]map[string]float64 `json:"matrix"`
+	Unavailable     map[string][]string           `json:"unavailable"`
 }
 
 // AdminClient provides access to the gossip cluster admin API
@@ -62,6 +184,28 @@ func (c *AdminClient) GetClusterInfo() (*ClusterInfo, error) {
 	return &info, nil
 }
 
+// ValidateConfig asks the admin server to validate a cluster config file
+// (JSON, same format as --config) without starting anything.
+// An invalid config is reported through ConfigValidation.Error, not as an error
+func (c *AdminClient) ValidateConfig(config []byte) (*ConfigValidation, error) {
+	resp, err := c.Client.Post(c.BaseURL+"/cluster", "application/json", bytes.NewReader(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return nil, fmt.Errorf("admin API returned status %d", resp.StatusCode)
+	}
+
+	var validation ConfigValidation
+	if err := json.NewDecoder(resp.Body).Decode(&validation); err != nil {
+		return nil, fmt.Errorf("failed to decode config validation: %w", err)
+	}
+
+	return &validation, nil
+}
+
 // GetNodes retrieves information about all nodes
 func (c *AdminClient) GetNodes() ([]NodeInfo, error) {
 	resp, err := c.Client.Get(c.BaseURL + "/nodes")
@@ -81,3 +225,143 @@ func (c *AdminClient) GetNodes() ([]NodeInfo, error) {
 
 	return nodes, nil
 }
+
+// AddNode asks the admin server to start a new node on the next free port.
+// Existing nodes' peers are rewired according to the active topology
+func (c *AdminClient) AddNode() (*NodeInfo, error) {
+	resp, err := c.Client.Post(c.BaseURL+"/nodes", "application/json", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add node: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("admin API returned status %d", resp.StatusCode)
+	}
+
+	var node NodeInfo
+	if err := json.NewDecoder(resp.Body).Decode(&node); err != nil {
+		return nil, fmt.Errorf("failed to decode added node: %w", err)
+	}
+
+	return &node, nil
+}
+
+// RemoveNode makes the node hand off its state, leave the cluster and stop
+func (c *AdminClient) RemoveNode(id string) error {
+	req, err := http.NewRequest(http.MethodDelete, c.BaseURL+"/nodes/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to remove node %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin API returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GetViews retrieves every node's peer sampling view and the in-degree distribution
+func (c *AdminClient) GetViews() (*ViewReport, error) {
+	resp, err := c.Client.Get(c.BaseURL + "/views")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get views: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin API returned status %d", resp.StatusCode)
+	}
+
+	var report ViewReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode views: %w", err)
+	}
+
+	return &report, nil
+}
+
+// GetHyParView retrieves every node's HyParView active and passive views
+func (c *AdminClient) GetHyParView() (*HyParViewReport, error) {
+	resp, err := c.Client.Get(c.BaseURL + "/hyparview")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hyparview views: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin API returned status %d", resp.StatusCode)
+	}
+
+	var report HyParViewReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode hyparview views: %w", err)
+	}
+
+	return &report, nil
+}
+
+// GetPlumtree retrieves the Plumtree spanning tree and redundant message counts
+func (c *AdminClient) GetPlumtree() (*PlumtreeReport, error) {
+	resp, err := c.Client.Get(c.BaseURL + "/plumtree")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plumtree report: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin API returned status %d", resp.StatusCode)
+	}
+
+	var report PlumtreeReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode plumtree report: %w", err)
+	}
+
+	return &report, nil
+}
+
+// GetLiveness retrieves every node's SWIM member view and per-member consensus
+func (c *AdminClient) GetLiveness() (*LivenessReport, error) {
+	resp, err := c.Client.Get(c.BaseURL + "/liveness")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get liveness: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin API returned status %d", resp.StatusCode)
+	}
+
+	var report LivenessReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode liveness: %w", err)
+	}
+
+	return &report, nil
+}
+
+// GetPhi retrieves the cluster-wide phi accrual matrix
+func (c *AdminClient) GetPhi() (*PhiReport, error) {
+	resp, err := c.Client.Get(c.BaseURL + "/phi")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get phi matrix: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin API returned status %d", resp.StatusCode)
+	}
+
+	var report PhiReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode phi matrix: %w", err)
+	}
+
+	return &report, nil
+}
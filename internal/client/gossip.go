@@ -2,24 +2,174 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"time"
 )
 
+// ErrRateLimited is returned when a node rejects a trigger because its
+// gossip token bucket is exhausted
+var ErrRateLimited = errors.New("gossip rate limit exceeded")
+
+// Version is the logical version (Lamport clock + origin node ID) of a value
+type Version struct {
+	Clock  uint64 `json:"clock"`
+	NodeID string `json:"node_id"`
+}
+
+// Sibling is one of several concurrent values kept in vclock mode
+type Sibling struct {
+	Value   string            `json:"value"`
+	Clock   map[string]uint64 `json:"clock"`
+	Version Version           `json:"version"`
+	Deleted bool              `json:"deleted,omitempty"`
+}
+
 // NodeStatus represents the status of a gossip node
 type NodeStatus struct {
 	ID       string   `json:"id"`
 	Value    string   `json:"value"`
+	Version  Version  `json:"version"`
+	Clock    uint64   `json:"clock"`
 	Peers    []string `json:"peers"`
 	LastSeen int64    `json:"last_seen"`
+	Paused   bool     `json:"paused"`
+	Left     bool     `json:"left"`
+
+	Membership []MemberRecord `json:"membership"`
+
+	GossipIntervalMs int64       `json:"gossip_interval_ms"`
+	GossipJitterMs   int64       `json:"gossip_jitter_ms"`
+	Fanout           int         `json:"fanout"`
+	PeerSelection    string      `json:"peer_selection"`
+	PeerSampling     string      `json:"peer_sampling"`
+	View             []ViewEntry `json:"view"`
+	PassiveView      []string    `json:"passive_view"`
+
+	FailureDetector string               `json:"failure_detector"`
+	Incarnation     uint64               `json:"incarnation"`
+	Members         []MemberStatus       `json:"members"`
+	PhiThreshold    float64              `json:"phi_threshold"`
+	Phi             map[string]PhiStatus `json:"phi"`
+
+	KeyCount    int    `json:"key_count"`
+	Tombstones  int    `json:"tombstone_count"`
+	VersionMode string `json:"version_mode"`
+
+	GossipMode    string          `json:"gossip_mode"`
+	HotRumors     int             `json:"hot_rumors"`
+	Dissemination string          `json:"dissemination"`
+	Traffic       TrafficStats    `json:"traffic"`
+	RateLimit     RateLimitStatus `json:"rate_limit"`
+	Faults        *FaultStatus    `json:"faults,omitempty"`
+
+	Siblings []Sibling `json:"siblings,omitempty"`
+	Context  string    `json:"context,omitempty"`
+}
+
+// TrafficStats reports gossip message counts and sizes for a node
+type TrafficStats struct {
+	MessagesSentFull   int64 `json:"messages_sent_full"`
+	MessagesSentDelta  int64 `json:"messages_sent_delta"`
+	MessagesSentDigest int64 `json:"messages_sent_digest"`
+	BytesSentFull      int64 `json:"bytes_sent_full"`
+	BytesSentDelta     int64 `json:"bytes_sent_delta"`
+	BytesSentDigest    int64 `json:"bytes_sent_digest"`
+	MessagesReceived   int64 `json:"messages_received"`
+	BytesReceived      int64 `json:"bytes_received"`
+	LastMessageBytes   int   `json:"last_message_bytes"`
+}
+
+// ViewEntry is one entry of a node's Cyclon partial view
+type ViewEntry struct {
+	Address string `json:"address"`
+	Age     int    `json:"age"`
 }
 
-// TriggerResponse represents the response from a gossip trigger
+// MemberStatus is a member's liveness as seen by one node's SWIM detector
+type MemberStatus struct {
+	Address     string `json:"address"`
+	State       string `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+	SinceMs     int64  `json:"since_ms"`
+}
+
+// PhiStatus is one peer's phi accrual suspicion level as seen by a node
+type PhiStatus struct {
+	Phi        float64 `json:"phi"`
+	Available  bool    `json:"available"`
+	Heartbeats int64   `json:"heartbeats"`
+	MeanMs     float64 `json:"mean_interval_ms"`
+	StdDevMs   float64 `json:"stddev_ms"`
+	LastMs     int64   `json:"since_last_ms"`
+}
+
+// MemberRecord is one entry of the gossiped membership list.
+// Status is "joined" or "left"; the record with the higher Version wins
+type MemberRecord struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	Version uint64 `json:"version"`
+}
+
+// LeaveResponse reports where a leaving node handed off its state
+type LeaveResponse struct {
+	Status    string   `json:"status"`
+	HandoffTo string   `json:"handoff_to"`
+	Notified  []string `json:"notified"`
+}
+
+// RateLimitStatus reports the state of a node's outgoing gossip token bucket
+type RateLimitStatus struct {
+	Enabled         bool  `json:"enabled"`
+	Capacity        int   `json:"capacity"`
+	PeriodMs        int64 `json:"period_ms"`
+	TokensRemaining int   `json:"tokens_remaining"`
+	DroppedSends    int64 `json:"dropped_sends"`
+}
+
+// FaultStatus reports a node's fault injection settings and dropped messages
+type FaultStatus struct {
+	DropRate float64 `json:"drop_rate"`
+	DelayMs  int64   `json:"delay_ms"`
+	Dropped  int64   `json:"dropped"`
+}
+
+// Entry represents a single key of a node's key/value store
+type Entry struct {
+	Key      string    `json:"key"`
+	Value    string    `json:"value"`
+	Version  Version   `json:"version"`
+	Siblings []Sibling `json:"siblings,omitempty"`
+	Context  string    `json:"context,omitempty"`
+}
+
+// Trigger modes accepted by /trigger
+const (
+	TriggerRandom          = "random"
+	TriggerRecursive       = "recursive"
+	TriggerRandomRecursive = "random-recursive"
+)
+
+// TriggerResponse represents the response from a gossip trigger.
+// Targets lists every peer contacted in the round (up to the node's fanout).
+// Status is "partial" when some targets failed; Results tells which
 type TriggerResponse struct {
-	Status string `json:"status"`
+	Status  string          `json:"status"`
+	Mode    string          `json:"mode"`
+	Targets []string        `json:"targets"`
+	Results []TriggerResult `json:"results"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// TriggerResult is the outcome of sending to one target ("sent" or "failed")
+type TriggerResult struct {
 	Target string `json:"target"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
 
 // GossipClient provides access to gossip node APIs
@@ -59,13 +209,32 @@ func (c *GossipClient) GetStatus(port int) (*NodeStatus, error) {
 
 // TriggerGossip triggers a gossip round on the specified node
 func (c *GossipClient) TriggerGossip(port int) (*TriggerResponse, error) {
-	url := fmt.Sprintf("http://localhost:%d/trigger", port)
+	return c.TriggerGossipMode(port, TriggerRandom)
+}
+
+// TriggerRecursiveGossip triggers recursive gossip over a binary tree rooted at the node
+func (c *GossipClient) TriggerRecursiveGossip(port int) (*TriggerResponse, error) {
+	return c.TriggerGossipMode(port, TriggerRecursive)
+}
+
+// TriggerRandomRecursiveGossip triggers recursive gossip over a tree with a random root
+func (c *GossipClient) TriggerRandomRecursiveGossip(port int) (*TriggerResponse, error) {
+	return c.TriggerGossipMode(port, TriggerRandomRecursive)
+}
+
+// TriggerGossipMode triggers a gossip round using the given trigger mode
+func (c *GossipClient) TriggerGossipMode(port int, mode string) (*TriggerResponse, error) {
+	url := fmt.Sprintf("http://localhost:%d/trigger?mode=%s", port, mode)
 	resp, err := c.Client.Post(url, "application/json", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to trigger gossip on port %d: %w", port, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("node at port %d: %w", port, ErrRateLimited)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("node at port %d returned status %d", port, resp.StatusCode)
 	}
@@ -80,9 +249,32 @@ func (c *GossipClient) TriggerGossip(port int) (*TriggerResponse, error) {
 
 // SetValue sets a new value on the specified node
 func (c *GossipClient) SetValue(port int, value string) error {
+	return c.SetValueWithContext(port, value, "")
+}
+
+// SetValueWithContext sets a new value, passing the context read from /status
+// so that the siblings it covers are resolved (vclock mode)
+func (c *GossipClient) SetValueWithContext(port int, value, context string) error {
+	return c.SetKeyWithContext(port, "", value, context)
+}
+
+// SetKey sets the value of a key on the specified node
+func (c *GossipClient) SetKey(port int, key, value string) error {
+	return c.SetKeyWithContext(port, key, value, "")
+}
+
+// SetKeyWithContext sets the value of a key, passing the context read from /get
+// (vclock mode). An empty key addresses the node's default key.
+func (c *GossipClient) SetKeyWithContext(port int, key, value, context string) error {
 	baseURL := fmt.Sprintf("http://localhost:%d/set", port)
 	params := url.Values{}
+	if key != "" {
+		params.Add("key", key)
+	}
 	params.Add("value", value)
+	if context != "" {
+		params.Add("context", context)
+	}
 	url := baseURL + "?" + params.Encode()
 
 	resp, err := c.Client.Post(url, "application/json", nil)
@@ -98,6 +290,126 @@ func (c *GossipClient) SetValue(port int, value string) error {
 	return nil
 }
 
+// GetKey retrieves a single key from the specified node.
+// The boolean result is false when the node does not hold the key.
+func (c *GossipClient) GetKey(port int, key string) (*Entry, bool, error) {
+	url := fmt.Sprintf("http://localhost:%d/get?%s", port, url.Values{"key": {key}}.Encode())
+	resp, err := c.Client.Get(url)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get key %q from port %d: %w", key, port, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("node at port %d returned status %d", port, resp.StatusCode)
+	}
+
+	var entry Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		return nil, false, fmt.Errorf("failed to decode key %q from port %d: %w", key, port, err)
+	}
+
+	return &entry, true, nil
+}
+
+// DeleteKey deletes a key on the specified node
+func (c *GossipClient) DeleteKey(port int, key string) error {
+	url := fmt.Sprintf("http://localhost:%d/delete?%s", port, url.Values{"key": {key}}.Encode())
+	resp, err := c.Client.Post(url, "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete key %q on port %d: %w", key, port, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("node at port %d returned status %d", port, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ListKeys retrieves the keys held by the specified node
+func (c *GossipClient) ListKeys(port int) ([]string, error) {
+	url := fmt.Sprintf("http://localhost:%d/keys", port)
+	resp, err := c.Client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys on port %d: %w", port, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("node at port %d returned status %d", port, resp.StatusCode)
+	}
+
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode keys from port %d: %w", port, err)
+	}
+
+	return result.Keys, nil
+}
+
+// SetGossipMode switches the gossip mode (push, pushpull, merkle or rumor) of the specified node
+func (c *GossipClient) SetGossipMode(port int, mode string) error {
+	return c.postControl(port, "/mode?"+url.Values{"mode": {mode}}.Encode())
+}
+
+// PauseGossip pauses the periodic gossip loop on the specified node
+func (c *GossipClient) PauseGossip(port int) error {
+	return c.postControl(port, "/pause")
+}
+
+// ResumeGossip resumes the periodic gossip loop on the specified node
+func (c *GossipClient) ResumeGossip(port int) error {
+	return c.postControl(port, "/resume")
+}
+
+// JoinCluster makes the specified node join the cluster through a seed address
+func (c *GossipClient) JoinCluster(port int, seed string) error {
+	return c.postControl(port, "/join?"+url.Values{"seed": {seed}}.Encode())
+}
+
+// LeaveCluster makes the specified node hand off its state and leave the cluster
+func (c *GossipClient) LeaveCluster(port int) (*LeaveResponse, error) {
+	url := fmt.Sprintf("http://localhost:%d/leave", port)
+	resp, err := c.Client.Post(url, "application/json", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to leave on port %d: %w", port, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("node at port %d returned status %d", port, resp.StatusCode)
+	}
+
+	var leave LeaveResponse
+	if err := json.NewDecoder(resp.Body).Decode(&leave); err != nil {
+		return nil, fmt.Errorf("failed to decode leave response from port %d: %w", port, err)
+	}
+
+	return &leave, nil
+}
+
+func (c *GossipClient) postControl(port int, path string) error {
+	url := fmt.Sprintf("http://localhost:%d%s", port, path)
+	resp, err := c.Client.Post(url, "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("failed to call %s on port %d: %w", path, port, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("node at port %d returned status %d", port, resp.StatusCode)
+	}
+
+	return nil
+}
+
 // CheckAllNodesHealthy checks if all nodes in the given port range are responding
 func (c *GossipClient) CheckAllNodesHealthy(basePort, nodeCount int) (int, error) {
 	healthy := 0
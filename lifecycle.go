@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+var ErrNodeStopping = errors.New("node is stopping")
+
+// 停止時にHTTPリクエストの完了を待つ上限
+const shutdownTimeout = 5 * time.Second
+
+// ピアへの1回の送信（応答の受信まで）の上限
+const peerRequestTimeout = 5 * time.Second
+
+// ノードのライフサイクル
+//   - Start: HTTPサーバーと定期処理（ゴシップ・tombstone GC・シャッフル・故障検出）を起動する
+//   - Stop: 定期処理と送信中のメッセージの完了を待ち、HTTPサーバーを止めて最終状態をログに出す
+//   - Wait: 停止が終わるまで待つ
+//
+// 親のcontextがキャンセルされる（SIGINT/SIGTERM）と、ノードは自分でStopする
+func (n *Node) Start(ctx context.Context, listener net.Listener) {
+	n.unwatch = context.AfterFunc(ctx, func() { n.Stop() })
+
+	go func() {
+		log.Printf("[%s] HTTP server starting on %s", n.ID, n.Address)
+		if err := n.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[%s] HTTP server failed: %v", n.ID, err)
+			n.lifecycleMu.Lock()
+			n.serveErr = err
+			n.lifecycleMu.Unlock()
+			go n.Stop()
+			return
+		}
+		log.Printf("[%s] HTTP server stopped", n.ID)
+	}()
+
+	n.StartGossipLoop()
+	n.StartTombstoneGC()
+	n.StartShuffleLoop()
+	n.StartFailureDetector()
+}
+
+// 停止する（複数回呼んでもよい）
+// 新しい定期処理・非同期送信は始めず、実行中のものが終わってからHTTPサーバーを止める
+// 送信中のリクエストは中断せずpeerRequestTimeoutまで完了を待ち、ctxは最後にキャンセルする
+// 障害注入の遅延中でまだ送っていないものは送らずに終わる
+func (n *Node) Stop() {
+	n.stopOnce.Do(func() {
+		if n.unwatch != nil {
+			n.unwatch()
+		}
+		n.lifecycleMu.Lock()
+		n.stopping = true
+		n.lifecycleMu.Unlock()
+		close(n.quit)
+		n.background.Wait()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := n.server.Shutdown(ctx); err != nil {
+			log.Printf("[%s] HTTP server shutdown: %v", n.ID, err)
+		}
+		n.cancel()
+		n.logSummary()
+		close(n.stopped)
+	})
+}
+
+// Stopが終わるまで待ち、HTTPサーバーが異常終了していればそのエラーを返す
+func (n *Node) Wait() error {
+	<-n.stopped
+	n.lifecycleMu.Lock()
+	defer n.lifecycleMu.Unlock()
+	return n.serveErr
+}
+
+// 定期処理や非同期送信をgoroutineで実行する（Stopはこれらの完了を待つ）
+// 停止処理が始まっていれば実行せずfalseを返す
+func (n *Node) spawn(f func()) bool {
+	n.lifecycleMu.Lock()
+	defer n.lifecycleMu.Unlock()
+	if n.stopping {
+		return false
+	}
+	n.background.Add(1)
+	go func() {
+		defer n.background.Done()
+		f()
+	}()
+	return true
+}
+
+// dだけ待つ。途中で停止が始まったらfalseを返す（定期処理と障害注入の遅延用）
+func (n *Node) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-n.quit:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// 停止時の最終状態
+func (n *Node) logSummary() {
+	n.mu.RLock()
+	tombstones := n.tombstoneCountLocked()
+	keys := len(n.Store) - tombstones
+	peers := len(n.Peers)
+	left := n.left
+	n.mu.RUnlock()
+
+	traffic := n.Traffic()
+	sent := traffic.MessagesSentFull + traffic.MessagesSentDelta + traffic.MessagesSentDigest
+	log.Printf("[%s] Node stopped: keys=%d tombstones=%d peers=%d left=%t merkle=%.8s sent=%d received=%d dropped=%d",
+		n.ID, keys, tombstones, peers, left, n.MerkleRoot(), sent, traffic.MessagesReceived, n.faultDrops.Load())
+}
+
+// ctxがキャンセルされるまでサーバーを動かし、キャンセル後は処理中のリクエストを待って止める
+func serveUntilDone(ctx context.Context, server *http.Server, listener net.Listener) error {
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
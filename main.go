@@ -1,30 +1,305 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-// グローバル変数でノード管理
-var allNodes []*Node
+// 全ノード共通の設定
+type NodeConfig struct {
+	GossipInterval time.Duration
+	GossipJitter   time.Duration
+	Fanout         int
+	PeerSelection  string
+	VersionMode    string
+	GossipMode     string
+	TombstoneGrace time.Duration
+	Dissemination  string
+	MaxDeltaKeys   int
+	MerkleDepth    int
+	RumorVariant   string
+	RumorK         int
+	GossipLimit    int
+	LimitPeriod    time.Duration
+	Topology       string
+
+	// ピアサンプリング（Cyclon/HyParView）
+	PeerSampling    string
+	ViewSize        int
+	ShuffleLength   int
+	ShuffleInterval time.Duration
+	HyParView       HyParViewConfig
+
+	// 故障検出（SWIM/phi accrual）
+	FailureDetector string
+	Swim            SwimConfig
+	Phi             PhiConfig
+
+	// 送信側の障害注入（設定ファイルではノードごとに上書きできる）
+	Faults FaultConfig
+}
+
+// 設定値の組み合わせを検証する（フラグと設定ファイルの両方で使う）
+func (c NodeConfig) Validate() error {
+	if c.VersionMode != VersionModeLWW && c.VersionMode != VersionModeVClock {
+		return fmt.Errorf("unknown version mode: %s", c.VersionMode)
+	}
+	if !validGossipMode(c.GossipMode) {
+		return fmt.Errorf("unknown gossip mode: %s", c.GossipMode)
+	}
+	if c.RumorVariant != RumorVariantCounter && c.RumorVariant != RumorVariantCoin {
+		return fmt.Errorf("unknown rumor variant: %s", c.RumorVariant)
+	}
+	if c.RumorK < 1 {
+		return fmt.Errorf("rumor k must be at least 1: %d", c.RumorK)
+	}
+	if c.MerkleDepth < 1 || c.MerkleDepth > 16 {
+		return fmt.Errorf("merkle depth must be between 1 and 16: %d", c.MerkleDepth)
+	}
+	if c.Dissemination != DisseminationFull && c.Dissemination != DisseminationDelta {
+		return fmt.Errorf("unknown dissemination mode: %s", c.Dissemination)
+	}
+	if c.Fanout < 1 {
+		return fmt.Errorf("fanout must be at least 1: %d", c.Fanout)
+	}
+	if !validPeerSelection(c.PeerSelection) {
+		return fmt.Errorf("unknown peer selection strategy: %s", c.PeerSelection)
+	}
+	if c.PeerSampling != PeerSamplingStatic && c.PeerSampling != PeerSamplingCyclon && c.PeerSampling != PeerSamplingHyParView {
+		return fmt.Errorf("unknown peer sampling: %s", c.PeerSampling)
+	}
+	h := c.HyParView
+	if h.ActiveSize < 1 || h.PassiveSize < 1 || h.PRWL > h.ARWL || h.PRWL < 0 {
+		return fmt.Errorf("invalid HyParView parameters: active %d, passive %d, arwl %d, prwl %d", h.ActiveSize, h.PassiveSize, h.ARWL, h.PRWL)
+	}
+	if h.ShuffleActive < 0 || h.ShufflePassive < 0 {
+		return fmt.Errorf("invalid HyParView shuffle parameters: active %d, passive %d", h.ShuffleActive, h.ShufflePassive)
+	}
+	if c.ViewSize < 1 || c.ShuffleLength < 1 || c.ShuffleLength > c.ViewSize {
+		return fmt.Errorf("invalid Cyclon parameters: view size %d, shuffle length %d", c.ViewSize, c.ShuffleLength)
+	}
+	if c.FailureDetector != FailureDetectorNone && c.FailureDetector != FailureDetectorSWIM && c.FailureDetector != FailureDetectorPhi {
+		return fmt.Errorf("unknown failure detector: %s", c.FailureDetector)
+	}
+	s := c.Swim
+	if c.FailureDetector == FailureDetectorSWIM && (s.Interval <= 0 || s.Timeout <= 0 || s.IndirectK < 0) {
+		return fmt.Errorf("invalid SWIM parameters: interval %v, timeout %v, k %d", s.Interval, s.Timeout, s.IndirectK)
+	}
+	p := c.Phi
+	if c.FailureDetector == FailureDetectorPhi && (p.Threshold <= 0 || p.WindowSize < 1 || p.MinStdDev <= 0 || p.FirstHeartbeat <= 0) {
+		return fmt.Errorf("invalid phi parameters: threshold %g, window %d, min stddev %v, first heartbeat %v", p.Threshold, p.WindowSize, p.MinStdDev, p.FirstHeartbeat)
+	}
+	if c.GossipLimit < 0 || (c.GossipLimit > 0 && c.LimitPeriod <= 0) {
+		return fmt.Errorf("invalid gossip limit: %d per %v", c.GossipLimit, c.LimitPeriod)
+	}
+	if c.Faults.DropRate < 0 || c.Faults.DropRate > 1 || c.Faults.Delay < 0 {
+		return fmt.Errorf("invalid fault injection: drop rate %g, delay %v", c.Faults.DropRate, c.Faults.Delay)
+	}
+	return nil
+}
 
 func main() {
+	mode := flag.String("mode", ModeCluster, "Run mode: cluster (all nodes in this process), single (one node per process) or admin (standalone admin server)")
+	nodeID := flag.String("id", "", "Node ID (single mode)")
+	listen := flag.String("listen", "", "Listen address such as localhost:18000 (single mode)")
+	peersFlag := flag.String("peers", "", "Comma-separated initial peer addresses (single mode)")
+	seedsFlag := flag.String("seeds", "", "Comma-separated seed addresses to join through (single mode) or to discover members from (admin mode)")
 	nodeCount := flag.Int("nodes", 10, "Number of nodes")
 	basePort := flag.Int("base-port", 18000, "Base port number")
 	adminPort := flag.Int("admin-port", 17999, "Admin service port")
+	gossipInterval := flag.Duration("gossip-interval", time.Second, "Periodic gossip interval (0 disables the background loop)")
+	gossipJitter := flag.Duration("gossip-jitter", 200*time.Millisecond, "Maximum random jitter added to each gossip interval")
+	versionMode := flag.String("version-mode", VersionModeLWW, "Value versioning mode: lww or vclock")
+	tombstoneGrace := flag.Duration("tombstone-grace", 30*time.Second, "Grace period before acknowledged tombstones are purged (0 keeps them forever)")
+	gossipMode := flag.String("gossip-mode", GossipModePush, "Initial gossip mode for every node: push, pushpull, merkle, rumor or plumtree")
+	dissemination := flag.String("dissemination", DisseminationFull, "State dissemination: full or delta")
+	maxDeltaKeys := flag.Int("delta-max-keys", 64, "Buffered delta keys per peer before falling back to full state")
+	merkleDepth := flag.Int("merkle-depth", 8, "Depth of the per-node Merkle tree (2^depth leaves)")
+	rumorVariant := flag.String("rumor-variant", RumorVariantCounter, "Rumor mongering loss of interest: counter or coin")
+	rumorK := flag.Int("rumor-k", 2, "Rumor mongering k (unnecessary contacts, or 1/k stop probability)")
+	fanout := flag.Int("fanout", 1, "Number of distinct peers to gossip to per round")
+	peerSelection := flag.String("peer-selection", PeerSelectionUniform, "Peer selection strategy: uniform, shuffle, least-recent or latency")
+	peerSampling := flag.String("peer-sampling", PeerSamplingStatic, "Peer sampling: static (topology peers), cyclon (shuffled partial views) or hyparview (active/passive overlay)")
+	viewSize := flag.Int("view-size", 8, "Cyclon partial view size")
+	shuffleLength := flag.Int("shuffle-length", 4, "Cyclon entries exchanged per shuffle")
+	shuffleInterval := flag.Duration("shuffle-interval", time.Second, "Cyclon shuffle interval (0 disables shuffling)")
+	activeViewSize := flag.Int("active-view-size", 4, "HyParView active view size")
+	passiveViewSize := flag.Int("passive-view-size", 16, "HyParView passive view size")
+	arwl := flag.Int("arwl", 6, "HyParView active random walk length")
+	prwl := flag.Int("prwl", 3, "HyParView passive random walk length")
+	shuffleActive := flag.Int("shuffle-active", 3, "HyParView active view entries sent per shuffle")
+	shufflePassive := flag.Int("shuffle-passive", 4, "HyParView passive view entries sent per shuffle")
+	topologyName := flag.String("topology", TopologyFullMesh, "Peer topology: full-mesh, ring, star, k-regular, erdos-renyi or watts-strogatz")
+	topologyK := flag.Int("topology-k", 4, "Degree for k-regular, ring-lattice degree for watts-strogatz (even)")
+	topologyP := flag.Float64("topology-p", 0.3, "Edge probability for erdos-renyi, rewiring probability for watts-strogatz")
+	topologySeed := flag.Int64("topology-seed", 0, "Random seed for topology generation (0 = time based)")
+	failureDetector := flag.String("failure-detector", FailureDetectorNone, "Failure detector: none, swim or phi")
+	swimInterval := flag.Duration("swim-interval", time.Second, "SWIM probe interval")
+	swimTimeout := flag.Duration("swim-timeout", 200*time.Millisecond, "SWIM ping timeout (ping-req waits twice as long)")
+	swimK := flag.Int("swim-k", 3, "SWIM members asked to ping-req after a failed ping")
+	swimSuspicion := flag.Duration("swim-suspicion", 3*time.Second, "SWIM suspicion timeout before a suspect is declared dead")
+	phiThreshold := flag.Float64("phi-threshold", 8, "Phi above which a peer is considered unavailable")
+	phiWindow := flag.Int("phi-window", 100, "Heartbeat inter-arrival samples kept per peer")
+	phiMinStdDev := flag.Duration("phi-min-stddev", 100*time.Millisecond, "Minimum standard deviation of heartbeat intervals")
+	phiFirstHeartbeat := flag.Duration("phi-first-heartbeat", 3*time.Second, "Estimated heartbeat interval before samples are available")
+	gossipLimit := flag.Int("gossip-limit", 0, "Outgoing gossip messages allowed per period (0 = unlimited, Riak uses 45)")
+	limitPeriod := flag.Duration("gossip-limit-period", 10*time.Second, "Token bucket refill period for --gossip-limit")
+	faultDropRate := flag.Float64("fault-drop-rate", 0, "Probability (0-1) of dropping each outgoing message (fault injection)")
+	faultDelay := flag.Duration("fault-delay", 0, "Delay added before each outgoing message (fault injection)")
+	configPath := flag.String("config", "", "Cluster config file (JSON); values in the file override the flags")
+	validateOnly := flag.Bool("validate", false, "Validate the configuration (flags and --config) and exit without starting anything")
 	flag.Parse()
 
-	log.Printf("Starting %d nodes...", *nodeCount)
+	switch *mode {
+	case ModeCluster:
+	case ModeSingle:
+		if *nodeID == "" {
+			log.Fatalf("Single mode requires --id")
+		}
+	case ModeAdmin:
+		if *seedsFlag == "" {
+			log.Fatalf("Admin mode requires --seeds")
+		}
+	default:
+		log.Fatalf("Unknown mode: %s", *mode)
+	}
+
+	config := NodeConfig{
+		GossipInterval:  *gossipInterval,
+		GossipJitter:    *gossipJitter,
+		Fanout:          *fanout,
+		PeerSelection:   *peerSelection,
+		PeerSampling:    *peerSampling,
+		ViewSize:        *viewSize,
+		ShuffleLength:   *shuffleLength,
+		ShuffleInterval: *shuffleInterval,
+		HyParView: HyParViewConfig{
+			ActiveSize:     *activeViewSize,
+			PassiveSize:    *passiveViewSize,
+			ARWL:           *arwl,
+			PRWL:           *prwl,
+			ShuffleActive:  *shuffleActive,
+			ShufflePassive: *shufflePassive,
+		},
+		VersionMode:     *versionMode,
+		GossipMode:      *gossipMode,
+		TombstoneGrace:  *tombstoneGrace,
+		Dissemination:   *dissemination,
+		MaxDeltaKeys:    *maxDeltaKeys,
+		MerkleDepth:     *merkleDepth,
+		RumorVariant:    *rumorVariant,
+		RumorK:          *rumorK,
+		GossipLimit:     *gossipLimit,
+		LimitPeriod:     *limitPeriod,
+		Topology:        *topologyName,
+		Faults:          FaultConfig{DropRate: *faultDropRate, Delay: *faultDelay},
+		FailureDetector: *failureDetector,
+		Swim: SwimConfig{
+			Interval:         *swimInterval,
+			Timeout:          *swimTimeout,
+			IndirectK:        *swimK,
+			SuspicionTimeout: *swimSuspicion,
+		},
+		Phi: PhiConfig{
+			Threshold:      *phiThreshold,
+			WindowSize:     *phiWindow,
+			MinStdDev:      *phiMinStdDev,
+			FirstHeartbeat: *phiFirstHeartbeat,
+		},
+	}
+
+	topologyConfig := TopologyConfig{Name: *topologyName, K: *topologyK, P: *topologyP, Seed: *topologySeed}
 
-	// ノードインスタンスを作成
-	allNodes = make([]*Node, *nodeCount)
+	// フラグの値を既定値とし、設定ファイルにある項目だけを上書きする
+	defaults := newClusterFile(config, topologyConfig, *basePort, *adminPort, *nodeCount)
+	file := defaults
+	if *configPath != "" {
+		if err := loadClusterFile(*configPath, &file); err != nil {
+			log.Fatalf("Failed to load config %s: %v", *configPath, err)
+		}
+	}
+	if *validateOnly {
+		validation := validateClusterFile(file)
+		output, _ := json.MarshalIndent(validation, "", "  ")
+		fmt.Println(string(output))
+		if !validation.Valid {
+			os.Exit(1)
+		}
+		return
+	}
+	plan, err := file.resolve()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// SIGINT/SIGTERMでキャンセルされるルートのcontext
+	// ノードと管理サーバーはこれを受けて、処理中のリクエストと送信を終えてから止まる
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch *mode {
+	case ModeSingle:
+		// 設定ファイルがあれば、--idのノードのアドレス・ピア・障害注入を使う
+		address, peers, nodeConfig := *listen, splitAddresses(*peersFlag), plan.Config
+		if *configPath != "" {
+			spec := plan.findSpec(*nodeID)
+			if spec == nil {
+				log.Fatalf("Node %s is not in config %s", *nodeID, *configPath)
+			}
+			if address == "" {
+				address = spec.Address
+			}
+			if len(peers) == 0 {
+				peers = spec.Peers
+			}
+			nodeConfig.Faults = spec.Faults
+		}
+		if address == "" {
+			log.Fatalf("Single mode requires --listen or a config file entry for %s", *nodeID)
+		}
+		if err := runSingleNode(ctx, *nodeID, address, peers, splitAddresses(*seedsFlag), nodeConfig); err != nil {
+			log.Fatalf("Node %s failed: %v", *nodeID, err)
+		}
+		log.Printf("Shutdown complete")
+		return
+	case ModeAdmin:
+		if err := startStandaloneAdmin(ctx, plan.AdminPort, splitAddresses(*seedsFlag), defaults); err != nil {
+			log.Fatalf("Admin server failed: %v", err)
+		}
+		log.Printf("Shutdown complete")
+		return
+	}
+
+	*nodeCount, *basePort, *adminPort = len(plan.Nodes), plan.BasePort, plan.AdminPort
+	log.Printf("Starting %d nodes...", *nodeCount)
 
 	// 全ノードを並行起動（バックグラウンド）
-	for i := 0; i < *nodeCount; i++ {
-		node := createNode(i, *basePort, *nodeCount)
-		allNodes[i] = node
-		go startHTTPServer(node)
+	// HyParViewではノードがnode-0へJOINしてオーバーレイを作るため、初期ピアはない
+	manager := newClusterManager(plan, defaults)
+	// 起動に失敗したら、起動済みのノードを止めてから終了する
+	if err := manager.Start(ctx, plan.Nodes, plan.Topology); err != nil {
+		log.Printf("Failed to start nodes: %v", err)
+		stop()
+		logClusterSummary()
+		log.Printf("Shutdown complete")
+		os.Exit(1)
+	}
+	if topology := manager.Topology(); plan.Config.PeerSampling != PeerSamplingHyParView {
+		log.Printf("Topology %s: %d edges (seed %d)", topology.Name, len(topology.Edges()), topology.Seed)
+		if !topology.Connected() {
+			log.Printf("Warning: topology %s is not connected, some nodes will never converge", topology.Name)
+		}
+	}
+	if plan.Config.Faults.Enabled() {
+		log.Printf("Fault injection: drop rate %g, delay %v", plan.Config.Faults.DropRate, plan.Config.Faults.Delay)
 	}
 
 	log.Printf("All %d nodes started successfully", *nodeCount)
@@ -32,39 +307,93 @@ func main() {
 	log.Printf("Node interaction:")
 	log.Printf("  Status:  curl localhost:%d/status", *basePort)
 	log.Printf("  Gossip:  curl -X POST localhost:%d/trigger", *basePort)
-	log.Printf("  Set:     curl -X POST 'localhost:%d/set?value=hello'", *basePort)
+	log.Printf("  Tree:    curl -X POST 'localhost:%d/trigger?mode=recursive'", *basePort)
+	log.Printf("  Set:     curl -X POST 'localhost:%d/set?key=greeting&value=hello'", *basePort)
+	log.Printf("  Get:     curl 'localhost:%d/get?key=greeting'", *basePort)
+	log.Printf("  Keys:    curl localhost:%d/keys", *basePort)
+	log.Printf("  Delete:  curl -X POST 'localhost:%d/delete?key=greeting'", *basePort)
+	log.Printf("  Counter: curl -X POST 'localhost:%d/counter/incr?key=hits'", *basePort)
+	log.Printf("  OR-Set:  curl -X POST 'localhost:%d/set/add?key=members&element=alice'", *basePort)
+	log.Printf("  Pause:   curl -X POST localhost:%d/pause", *basePort)
+	log.Printf("  Resume:  curl -X POST localhost:%d/resume", *basePort)
+	log.Printf("  Mode:    curl -X POST 'localhost:%d/mode?mode=merkle'", *basePort)
+	log.Printf("  Leave:   curl -X POST localhost:%d/leave", *basePort+1)
+	log.Printf("  Join:    curl -X POST 'localhost:%d/join?seed=localhost:%d'", *basePort+1, *basePort)
 	log.Printf("")
 	log.Printf("Admin service:")
 	log.Printf("  Cluster info: curl localhost:%d/cluster", *adminPort)
 	log.Printf("  Node list:    curl localhost:%d/nodes", *adminPort)
 	log.Printf("  Health check: curl localhost:%d/health", *adminPort)
+	log.Printf("  Merkle roots: curl localhost:%d/merkle", *adminPort)
 	log.Printf("")
 
 	// 管理サービスをメイン実行（フォアグラウンド）
-	// Ctrl+Cで全体が終了する
-	startAdminServer(*adminPort, *nodeCount, *basePort)
-}
-
-func createNode(nodeIndex, basePort, totalNodes int) *Node {
-	nodeID := fmt.Sprintf("node-%d", nodeIndex)
-	address := fmt.Sprintf("localhost:%d", basePort+nodeIndex)
-
-	// フルメッシュのピアリストを動的生成
-	var peers []string
-	for i := 0; i < totalNodes; i++ {
-		if i != nodeIndex { // 自分以外
-			peers = append(peers, fmt.Sprintf("localhost:%d", basePort+i))
-		}
+	// Ctrl+Cで管理サーバー、全ノードの順に止め、最終状態をログに出す
+	if err := startAdminServer(ctx, *adminPort, manager); err != nil {
+		log.Printf("Admin server failed: %v", err)
 	}
+	stop()
+	manager.Stop()
+	logClusterSummary()
+	log.Printf("Shutdown complete")
+}
 
+// peersはトポロジーの隣接ノードのアドレス
+func createNode(nodeID, address string, peers []string, config NodeConfig) *Node {
 	node := &Node{
 		ID:       nodeID,
 		Address:  address,
 		Peers:    peers,
-		Value:    "initial-state",
+		Store:    map[string]*Entry{DefaultKey: newInitialEntry(DefaultKey, "initial-state", config.VersionMode)},
+		States:   map[string]State{},
+		purged:   map[string]Version{},
 		LastSeen: 0,
+
+		GossipInterval: config.GossipInterval,
+		GossipJitter:   config.GossipJitter,
+		Fanout:         config.Fanout,
+		selector:       newPeerSelector(config.PeerSelection),
+
+		PeerSampling:    config.PeerSampling,
+		ViewSize:        config.ViewSize,
+		ShuffleLength:   config.ShuffleLength,
+		ShuffleInterval: config.ShuffleInterval,
+		HyParView:       config.HyParView,
+
+		VersionMode:    config.VersionMode,
+		TombstoneGrace: config.TombstoneGrace,
+
+		gossipMode:    config.GossipMode,
+		RumorVariant:  config.RumorVariant,
+		RumorK:        config.RumorK,
+		hotRumors:     map[string]*rumor{},
+		plumtree:      newPlumtreeState(),
+		Dissemination: config.Dissemination,
+		MaxDeltaKeys:  config.MaxDeltaKeys,
+		deltaBuffers:  map[string]*deltaBuffer{},
+		limiter:       NewTokenBucket(config.GossipLimit, config.LimitPeriod),
+		faults:        config.Faults,
+
+		// フルメッシュでは新たに参加したメンバーとも直接ゴシップする
+		autoPeer: config.Topology == TopologyFullMesh && config.PeerSampling != PeerSamplingHyParView,
 	}
 
+	switch config.FailureDetector {
+	case FailureDetectorSWIM:
+		node.swim = newSwimState(config.Swim)
+	case FailureDetectorPhi:
+		node.phi = newPhiDetector(config.Phi)
+	}
+
+	node.rebuildMerkle(config.MerkleDepth)
+	node.initView()
+	node.initMembership()
+	node.server = &http.Server{Addr: address, Handler: newNodeMux(node)}
+	node.client = &http.Client{Timeout: peerRequestTimeout}
+	node.ctx, node.cancel = context.WithCancel(context.Background())
+	node.quit = make(chan struct{})
+	node.stopped = make(chan struct{})
+
 	log.Printf("Starting node %s on %s", node.ID, node.Address)
 	return node
 }
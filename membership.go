@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+)
+
+var ErrNodeLeft = errors.New("node has left the cluster")
+
+// メンバーの参加状態
+const (
+	MembershipJoined = "joined"
+	MembershipLeft   = "left"
+)
+
+// メンバーシップリストの1エントリ
+// Versionは本人だけが参加・離脱のたびに増やし、大きい方が優先される
+type MemberRecord struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	Version uint64 `json:"version"`
+}
+
+// /membershipで交換するメンバーシップリスト
+type MembershipMessage struct {
+	From    string         `json:"from"`
+	Members []MemberRecord `json:"members"`
+}
+
+// 離脱時のハンドオフ結果
+type LeaveResult struct {
+	HandoffTo string   `json:"handoff_to"`
+	Notified  []string `json:"notified"`
+}
+
+// 自分自身のレコードで初期化する
+func (n *Node) initMembership() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.membership = map[string]*MemberRecord{
+		n.Address: {ID: n.ID, Address: n.Address, Status: MembershipJoined, Version: 1},
+	}
+}
+
+// メンバーシップリスト（アドレス順）
+func (n *Node) Membership() []MemberRecord {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.membershipLocked()
+}
+
+func (n *Node) membershipLocked() []MemberRecord {
+	records := make([]MemberRecord, 0, len(n.membership))
+	for _, record := range n.membership {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Address < records[j].Address })
+	return records
+}
+
+// 離脱済みか
+func (n *Node) HasLeft() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.left
+}
+
+// 受け取ったメンバーシップリストを取り込み、Peersへ反映する
+//   - 離脱したメンバーはPeersから外す
+//   - 参加したメンバーは、フルメッシュ（autoPeer）か直接の相手（direct）ならPeersへ加える
+func (n *Node) MergeMembership(records []MemberRecord, direct string) {
+	// hyparviewでアクティブビューのメンバーが離脱したらパッシブビューから補う
+	if n.mergeMembership(records, direct) && n.PeerSampling == PeerSamplingHyParView {
+		n.spawn(n.repairActive)
+	}
+}
+
+// アクティブなピアが離脱していた場合trueを返す
+func (n *Node) mergeMembership(records []MemberRecord, direct string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	lostPeer := false
+	for _, record := range records {
+		if record.Address == "" {
+			continue
+		}
+		// 自分のレコードは自分だけが更新する
+		// 再起動前の古い状態が残っていたら、バージョンを上げて現在の状態で上書きする
+		if record.Address == n.Address {
+			if self := n.membership[n.Address]; record.Version >= self.Version && record.Status != self.Status {
+				self.Version = record.Version + 1
+			}
+			continue
+		}
+		current, ok := n.membership[record.Address]
+		if ok && record.Version <= current.Version {
+			continue
+		}
+		updated := record
+		n.membership[record.Address] = &updated
+		log.Printf("[%s] Member %s (%s) %s (version %d)", n.ID, record.ID, record.Address, record.Status, record.Version)
+
+		if record.Status == MembershipLeft {
+			lostPeer = lostPeer || containsString(n.Peers, record.Address)
+			n.removePeerLocked(record.Address)
+		} else if n.autoPeer || record.Address == direct {
+			n.addPeerLocked(record.Address)
+		}
+	}
+	return lostPeer
+}
+
+// Peersへ加える（呼び出し側でロックを保持していること）
+func (n *Node) addPeerLocked(peer string) {
+	if n.left || peer == n.Address || containsString(n.Peers, peer) {
+		return
+	}
+	if n.PeerSampling == PeerSamplingHyParView {
+		// hyparviewのアクティブビューはJOIN/NEIGHBORでのみ変わる
+		return
+	}
+	n.Peers = append(n.Peers, peer)
+	if n.PeerSampling == PeerSamplingCyclon && len(n.view) < n.ViewSize && viewIndex(n.view, peer) < 0 {
+		n.view = append(n.view, ViewEntry{Address: peer})
+	}
+}
+
+// トポロジーの再適用でPeersを置き換える
+func (n *Node) setPeers(peers []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.left {
+		return
+	}
+	n.Peers = peers
+}
+
+// Peersと各ビューから外す（呼び出し側でロックを保持していること）
+func (n *Node) removePeerLocked(peer string) {
+	n.Peers = removeString(n.Peers, peer)
+	n.passive = removeString(n.passive, peer)
+	if i := viewIndex(n.view, peer); i >= 0 {
+		n.view = append(n.view[:i], n.view[i+1:]...)
+	}
+}
+
+// seedを経由してクラスターへ参加する
+// seedとメンバーシップリストを交換し、hyparviewの場合はJOINも行う
+func (n *Node) JoinCluster(seed string) error {
+	if seed == "" || seed == n.Address {
+		return fmt.Errorf("invalid seed: %q", seed)
+	}
+
+	n.mu.Lock()
+	self := n.membership[n.Address]
+	if n.left || self.Status != MembershipJoined {
+		self.Status = MembershipJoined
+		self.Version++
+	}
+	n.left = false
+	request := MembershipMessage{From: n.Address, Members: n.membershipLocked()}
+	n.mu.Unlock()
+
+	var response MembershipMessage
+	if _, err := n.postJSON(seed, "/membership", request, &response); err != nil {
+		return fmt.Errorf("failed to contact seed %s: %w", seed, err)
+	}
+	n.MergeMembership(response.Members, seed)
+
+	// 再参加の場合、既知のメンバーは上のマージでは更新されないためここで戻す
+	n.mu.Lock()
+	n.addPeerLocked(seed)
+	if n.autoPeer {
+		for address, record := range n.membership {
+			if record.Status == MembershipJoined {
+				n.addPeerLocked(address)
+			}
+		}
+	}
+	n.mu.Unlock()
+
+	if n.PeerSampling == PeerSamplingHyParView {
+		if err := n.Join(seed); err != nil {
+			return err
+		}
+	}
+	log.Printf("[%s] Joined cluster via seed %s", n.ID, seed)
+	return nil
+}
+
+// /membershipの受信処理: 相手のリストを取り込み、自分のリストを返す
+func (n *Node) HandleMembership(message MembershipMessage) MembershipMessage {
+	n.MergeMembership(message.Members, message.From)
+	return MembershipMessage{From: n.Address, Members: n.Membership()}
+}
+
+// クラスターから離脱する
+// 1. 自分のレコードをleftにしてバージョンを上げ、ゴシップを止める（/pauseの状態は変えない）
+// 2. 生きているピアの1つへ全状態を送って引き継ぐ（失敗したら次のピア）
+// 3. 残りのピアへ離脱をメンバーシップリストで直接知らせる
+// 4. onLeaveがあれば呼ぶ（クラスターモードではトポロジーから除かれる）
+func (n *Node) Leave() (LeaveResult, error) {
+	n.mu.Lock()
+	if n.left {
+		n.mu.Unlock()
+		return LeaveResult{}, ErrNodeLeft
+	}
+	self := n.membership[n.Address]
+	self.Status = MembershipLeft
+	self.Version++
+	n.left = true
+	peers := append([]string(nil), n.Peers...)
+	members := n.membershipLocked()
+	n.mu.Unlock()
+
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+
+	var result LeaveResult
+	handoff := GossipMessage{
+		From:    n.ID,
+		Entries: n.Entries(),
+		States:  n.StateEntries(),
+	}
+	for _, peer := range peers {
+		if n.isDead(peer) {
+			continue
+		}
+		size, err := n.sendHTTPMessage(peer, handoff)
+		if err != nil {
+			log.Printf("[%s] Handoff to %s failed: %v", n.ID, peer, err)
+			continue
+		}
+		n.recordSent(size, trafficFull)
+		result.HandoffTo = peer
+		break
+	}
+	if result.HandoffTo == "" && len(peers) > 0 {
+		// 状態を失わないよう、離脱を取り消してクラスターに留まる
+		n.mu.Lock()
+		self.Status = MembershipJoined
+		self.Version++
+		n.left = false
+		n.mu.Unlock()
+		return result, fmt.Errorf("no peer accepted the state handoff")
+	}
+
+	notice := MembershipMessage{From: n.Address, Members: members}
+	for _, peer := range peers {
+		if _, err := n.postJSON(peer, "/membership", notice, nil); err == nil {
+			result.Notified = append(result.Notified, peer)
+		}
+	}
+
+	n.mu.Lock()
+	n.Peers = nil
+	n.view = nil
+	n.passive = nil
+	n.mu.Unlock()
+
+	log.Printf("[%s] Left cluster: state handed off to %s, %d peers notified", n.ID, result.HandoffTo, len(result.Notified))
+	if n.onLeave != nil {
+		n.onLeave()
+	}
+	return result, nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Merkle木に載せる項目キーの接頭辞（KVエントリとCRDT状態を同じ木で扱う）
+const (
+	merkleEntryPrefix = "kv/"
+	merkleStatePrefix = "crdt/"
+)
+
+// キー空間を固定深さの二分木に分割したMerkle木
+// 項目はキーのハッシュで葉に振り分け、更新時は葉から根までを再計算する（O(depth)）
+type MerkleTree struct {
+	depth  int
+	nodes  [][32]byte            // ヒープ配置（0が根、iの子は2i+1と2i+2）
+	leaves []map[string][32]byte // 葉ごとの 項目キー -> 項目ハッシュ
+}
+
+func NewMerkleTree(depth int) *MerkleTree {
+	leafCount := 1 << depth
+	t := &MerkleTree{
+		depth:  depth,
+		nodes:  make([][32]byte, 2*leafCount-1),
+		leaves: make([]map[string][32]byte, leafCount),
+	}
+	for i := range t.leaves {
+		t.leaves[i] = map[string][32]byte{}
+	}
+	return t
+}
+
+func (t *MerkleTree) Depth() int { return t.depth }
+
+func (t *MerkleTree) Root() [32]byte { return t.nodes[0] }
+
+func (t *MerkleTree) leafIndex(itemKey string) int {
+	sum := sha256.Sum256([]byte(itemKey))
+	return int(binary.BigEndian.Uint32(sum[:4]) >> (32 - t.depth))
+}
+
+// 葉の番号からヒープ上の位置へ
+func (t *MerkleTree) leafNode(leaf int) int {
+	return (1 << t.depth) - 1 + leaf
+}
+
+// 項目の追加・更新
+func (t *MerkleTree) Update(itemKey string, hash [32]byte) {
+	leaf := t.leafIndex(itemKey)
+	if current, ok := t.leaves[leaf][itemKey]; ok && current == hash {
+		return
+	}
+	t.leaves[leaf][itemKey] = hash
+	t.rehash(leaf)
+}
+
+// 項目の削除
+func (t *MerkleTree) Remove(itemKey string) {
+	leaf := t.leafIndex(itemKey)
+	if _, ok := t.leaves[leaf][itemKey]; !ok {
+		return
+	}
+	delete(t.leaves[leaf], itemKey)
+	t.rehash(leaf)
+}
+
+// 葉のハッシュを再計算し、根までの経路を更新する
+// 空の部分木はゼロ値とし、項目が同じなら木の形に依らず同じハッシュになる
+func (t *MerkleTree) rehash(leaf int) {
+	items := t.leaves[leaf]
+	var hash [32]byte
+	if len(items) > 0 {
+		keys := make([]string, 0, len(items))
+		for key := range items {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		h := sha256.New()
+		for _, key := range keys {
+			itemHash := items[key]
+			h.Write([]byte(key))
+			h.Write(itemHash[:])
+		}
+		copy(hash[:], h.Sum(nil))
+	}
+
+	i := t.leafNode(leaf)
+	t.nodes[i] = hash
+	for i > 0 {
+		i = (i - 1) / 2
+		left, right := t.nodes[2*i+1], t.nodes[2*i+2]
+		if left == ([32]byte{}) && right == ([32]byte{}) {
+			t.nodes[i] = [32]byte{}
+			continue
+		}
+		t.nodes[i] = sha256.Sum256(append(left[:], right[:]...))
+	}
+}
+
+// 項目がヒープ位置indexの部分木に含まれるか
+func (t *MerkleTree) covers(index int, itemKey string) bool {
+	i := t.leafNode(t.leafIndex(itemKey))
+	for i != index && i > 0 {
+		i = (i - 1) / 2
+	}
+	return i == index
+}
+
+// 指定したヒープ位置のハッシュ（範囲外は空文字列）
+func (t *MerkleTree) NodeHashes(indices []int) []string {
+	hashes := make([]string, len(indices))
+	for i, index := range indices {
+		if index >= 0 && index < len(t.nodes) {
+			hashes[i] = hex.EncodeToString(t.nodes[index][:])
+		}
+	}
+	return hashes
+}
+
+// 指定した葉に含まれる項目
+func (t *MerkleTree) LeafItems(leaves []int) map[string]string {
+	items := map[string]string{}
+	for _, leaf := range leaves {
+		if leaf < 0 || leaf >= len(t.leaves) {
+			continue
+		}
+		for key, hash := range t.leaves[leaf] {
+			items[key] = hex.EncodeToString(hash[:])
+		}
+	}
+	return items
+}
+
+// 項目数
+func (t *MerkleTree) Size() int {
+	size := 0
+	for _, items := range t.leaves {
+		size += len(items)
+	}
+	return size
+}
+
+// 現在の全エントリ・CRDT状態から木を作り直す（起動時に使用）
+// 呼び出し側でロックを保持していること
+func (n *Node) rebuildMerkle(depth int) {
+	n.merkle = NewMerkleTree(depth)
+	for _, entry := range n.Store {
+		n.updateMerkleEntry(entry)
+	}
+	for key, state := range n.States {
+		n.updateMerkleState(key, state)
+	}
+}
+
+// KVエントリの項目ハッシュ（ダイジェストと同じくバージョン情報のみを対象にする）
+// 呼び出し側でロックを保持していること
+func (n *Node) updateMerkleEntry(entry *Entry) {
+	data, _ := json.Marshal(n.digestEntryLocked(entry))
+	n.merkle.Update(merkleEntryPrefix+entry.Key, sha256.Sum256(data))
+}
+
+// CRDT状態の項目ハッシュ
+// 呼び出し側でロックを保持していること
+func (n *Node) updateMerkleState(key string, state State) {
+	data, _ := state.Marshal()
+	n.merkle.Update(merkleStatePrefix+key, sha256.Sum256(data))
+}
+
+// 指定したヒープ位置の部分木に含まれるtombstone
+// 呼び出し側でロックを保持していること
+func (n *Node) tombstonesUnderLocked(indices []int) []Entry {
+	var tombstones []Entry
+	if len(indices) == 0 {
+		return tombstones
+	}
+	for key, entry := range n.Store {
+		if !entry.Deleted {
+			continue
+		}
+		for _, index := range indices {
+			if n.merkle.covers(index, merkleEntryPrefix+key) {
+				tombstones = append(tombstones, Entry{Key: key, Version: entry.Version, Deleted: true})
+				break
+			}
+		}
+	}
+	return tombstones
+}
+
+// Merkle木の根ハッシュ
+func (n *Node) MerkleRoot() string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	root := n.merkle.Root()
+	return hex.EncodeToString(root[:])
+}
+
+// /merkle のリクエスト（ヒープ位置のハッシュ、または葉の項目を問い合わせる）
+type MerkleRequest struct {
+	Nodes  []int `json:"nodes,omitempty"`
+	Leaves []int `json:"leaves,omitempty"`
+}
+
+type MerkleResponse struct {
+	Depth  int               `json:"depth"`
+	Hashes []string          `json:"hashes,omitempty"`
+	Items  map[string]string `json:"items,omitempty"`
+}
+
+// Merkle問い合わせの受信処理
+func (n *Node) HandleMerkleRequest(request MerkleRequest) MerkleResponse {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	response := MerkleResponse{Depth: n.merkle.Depth()}
+	if len(request.Nodes) > 0 {
+		response.Hashes = n.merkle.NodeHashes(request.Nodes)
+	}
+	if len(request.Leaves) > 0 {
+		response.Items = n.merkle.LeafItems(request.Leaves)
+	}
+	return response
+}
+
+// Merkle型anti-entropy
+// 根から差分のある部分木だけを辿って食い違う葉を特定し、その項目のみダイジェスト交換する
+// ハッシュの一致した部分木にあるtombstoneは、相手も同じバージョンを持つため確認済みとする
+func (n *Node) merkleGossip(target string) error {
+	frontier := []int{0}
+	var localHashes []string
+	var synced []Entry
+	defer func() { n.recordTombstoneAcks(target, synced) }()
+	for level := 0; ; level++ {
+		var response MerkleResponse
+		size, err := n.postJSON(target, "/merkle", MerkleRequest{Nodes: frontier}, &response)
+		if err != nil {
+			return err
+		}
+		n.recordSent(size, trafficDigest)
+
+		n.mu.RLock()
+		depth := n.merkle.Depth()
+		localHashes = n.merkle.NodeHashes(frontier)
+		if response.Depth != depth || len(response.Hashes) != len(frontier) {
+			n.mu.RUnlock()
+			if response.Depth != depth {
+				return fmt.Errorf("merkle depth mismatch: local %d, remote %d", depth, response.Depth)
+			}
+			return fmt.Errorf("merkle response has %d hashes for %d nodes", len(response.Hashes), len(frontier))
+		}
+
+		var differing, matching []int
+		for i, index := range frontier {
+			if localHashes[i] != response.Hashes[i] {
+				differing = append(differing, index)
+			} else {
+				matching = append(matching, index)
+			}
+		}
+		synced = append(synced, n.tombstonesUnderLocked(matching)...)
+		n.mu.RUnlock()
+		if len(differing) == 0 {
+			log.Printf("[%s] Merkle exchange with %s: in sync (level %d)", n.ID, target, level)
+			return nil
+		}
+		if level == depth {
+			return n.reconcileMerkleLeaves(target, differing, depth)
+		}
+
+		frontier = frontier[:0:0]
+		for _, index := range differing {
+			frontier = append(frontier, 2*index+1, 2*index+2)
+		}
+	}
+}
+
+// 食い違う葉の項目を比較し、差分のあるキーだけをダイジェスト交換で同期する
+func (n *Node) reconcileMerkleLeaves(target string, leafNodes []int, depth int) error {
+	leaves := make([]int, len(leafNodes))
+	for i, index := range leafNodes {
+		leaves[i] = index - ((1 << depth) - 1)
+	}
+
+	var response MerkleResponse
+	size, err := n.postJSON(target, "/merkle", MerkleRequest{Leaves: leaves}, &response)
+	if err != nil {
+		return err
+	}
+	n.recordSent(size, trafficDigest)
+
+	n.mu.RLock()
+	local := n.merkle.LeafItems(leaves)
+	var synced []Entry
+	divergent := map[string]bool{}
+	for itemKey, hash := range local {
+		if response.Items[itemKey] != hash {
+			divergent[itemKey] = true
+		} else if key, ok := strings.CutPrefix(itemKey, merkleEntryPrefix); ok {
+			if entry, ok := n.Store[key]; ok && entry.Deleted {
+				synced = append(synced, Entry{Key: key, Version: entry.Version, Deleted: true})
+			}
+		}
+	}
+	n.mu.RUnlock()
+	n.recordTombstoneAcks(target, synced)
+
+	for key := range response.Items {
+		if _, ok := local[key]; !ok {
+			divergent[key] = true
+		}
+	}
+
+	scope := &DigestScope{}
+	for itemKey := range divergent {
+		if key, ok := strings.CutPrefix(itemKey, merkleEntryPrefix); ok {
+			scope.Entries = append(scope.Entries, key)
+		} else if key, ok := strings.CutPrefix(itemKey, merkleStatePrefix); ok {
+			scope.States = append(scope.States, key)
+		}
+	}
+	sort.Strings(scope.Entries)
+	sort.Strings(scope.States)
+
+	log.Printf("[%s] Merkle exchange with %s: %d divergent leaves, %d divergent keys",
+		n.ID, target, len(leaves), len(divergent))
+	return n.exchangeDigest(target, n.BuildScopedDigest(scope))
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/hex"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,39 +13,213 @@ type Node struct {
 	mu       sync.RWMutex
 	ID       string
 	Address  string
-	Value    string
+	Store    map[string]*Entry
+	States   map[string]State
 	Peers    []string
 	LastSeen int64
+
+	// 論理バージョン管理
+	VersionMode string
+	Clock       uint64
+
+	// tombstoneを削除するまでの猶予期間
+	TombstoneGrace time.Duration
+	// GCしたtombstoneのバージョン（キーごとの最大値）
+	// これ以下のバージョンを受け取ってもキーを復活させない
+	purged map[string]Version
+
+	// ゴシップモード（push/pushpull/merkle/rumor）
+	gossipMode string
+
+	// rumor mongeringの設定と拡散中のrumor
+	RumorVariant string
+	RumorK       int
+	hotRumors    map[string]*rumor
+	// SWIMの故障検出（無効ならnil）
+	swim *swimState
+	// phi accrual故障検出（無効ならnil）
+	phi *phiDetector
+	// plumtreeモードのeager/lazyピアと受信済みメッセージ
+	plumtree *plumtreeState
+
+	// キー空間のMerkle木（SetValue/HandleGossipMessageのたびに差分更新）
+	merkle *MerkleTree
+
+	// 状態の配信モード（full/delta）とピアごとの差分バッファ
+	Dissemination string
+	MaxDeltaKeys  int
+	deltaBuffers  map[string]*deltaBuffer
+
+	// 送信ゴシップのレート制限
+	limiter *TokenBucket
+
+	// 送信時の障害注入（遅延・ドロップ）と落とした数
+	faults     FaultConfig
+	faultDrops atomic.Int64
+
+	// 送受信量の統計
+	trafficMu sync.Mutex
+	traffic   TrafficStats
+
+	// 定期ゴシップ設定
+	GossipInterval time.Duration
+	GossipJitter   time.Duration
+	paused         bool
+
+	// ピアサンプリング（cyclonの場合、送信先はPeersではなく部分ビューから選ぶ）
+	PeerSampling    string
+	ViewSize        int
+	ShuffleLength   int
+	ShuffleInterval time.Duration
+	view            []ViewEntry
+	// hyparviewの場合、Peersがアクティブビューになる
+	HyParView   HyParViewConfig
+	passive     []string
+	lastShuffle []string
+
+	// 1ラウンドあたりの送信先ピア数（非復元抽出）と選択戦略
+	Fanout   int
+	selector PeerSelector
+
+	// ゴシップで伝わるメンバーシップリスト（アドレス -> レコード）
+	// autoPeerがtrueなら、新たに参加したメンバーを自動的にPeersへ加える（フルメッシュ）
+	membership map[string]*MemberRecord
+	autoPeer   bool
+	left       bool
+	// 離脱が完了したときに呼ぶ（クラスターモードで管理側がトポロジーから除くため）
+	onLeave func()
+
+	// HTTPサーバーとライフサイクル（lifecycle.go）
+	// quitはStopの開始時に閉じ、定期処理を終わらせる
+	// ctxは送信のcontextの親で、送信中のものを待ち終えてからキャンセルする
+	// backgroundはspawnで起動した定期処理・非同期送信
+	// clientはピアへの送信用（応答しないピアで停止が止まらないようタイムアウトを付ける）
+	server      *http.Server
+	client      *http.Client
+	ctx         context.Context
+	cancel      context.CancelFunc
+	quit        chan struct{}
+	background  sync.WaitGroup
+	lifecycleMu sync.Mutex
+	stopping    bool
+	serveErr    error
+	unwatch     func() bool
+	stopOnce    sync.Once
+	stopped     chan struct{}
 }
 
 // NewNode関数は不要になったため削除
 
-// thread-safeな値の取得
+// thread-safeな値の取得（デフォルトキー）
 func (n *Node) GetValue() string {
+	value, _ := n.GetVersionedValue()
+	return value
+}
+
+// thread-safeな値とバージョンの取得（デフォルトキー）
+func (n *Node) GetVersionedValue() (string, Version) {
+	entry, _ := n.Get(DefaultKey)
+	return entry.Value, entry.Version
+}
+
+// thread-safeな値の更新（デフォルトキーへのローカル書き込み）
+func (n *Node) SetValue(value string) Version {
+	return n.Set(DefaultKey, value, nil)
+}
+
+// thread-safeなピア数の取得
+func (n *Node) PeerCount() int {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
-	return n.Value
+	return len(n.Peers)
 }
 
-// thread-safeな値の更新
-func (n *Node) SetValue(value string) {
-	n.mu.Lock()
-	defer n.mu.Unlock()
-	if n.Value != value {
-		log.Printf("[%s] Value updated: '%s' -> '%s'", n.ID, n.Value, value)
-		n.Value = value
-		n.LastSeen = time.Now().Unix()
-	}
+// 最後に値を受け取った時刻（Unix秒）
+func (n *Node) GetLastSeen() int64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.LastSeen
 }
 
 // ステータス情報取得
 func (n *Node) GetStatus() map[string]interface{} {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
-	return map[string]interface{}{
-		"id":        n.ID,
-		"value":     n.Value,
-		"peers":     n.Peers,
-		"last_seen": n.LastSeen,
+
+	// value/versionは単一値時代との互換のためデフォルトキーの内容を返す
+	var value string
+	var version Version
+	entry := n.Store[DefaultKey]
+	if entry != nil && !entry.Deleted {
+		value, version = entry.Value, entry.Version
+	}
+	tombstones := n.tombstoneCountLocked()
+	merkleRoot := n.merkle.Root()
+
+	status := map[string]interface{}{
+		"id":         n.ID,
+		"value":      value,
+		"version":    version,
+		"clock":      n.Clock,
+		"key_count":  len(n.Store) - tombstones,
+		"crdt_count": len(n.States),
+		"peers":      n.Peers,
+		"last_seen":  n.LastSeen,
+		"paused":     n.paused,
+		"left":       n.left,
+		"membership": n.membershipLocked(),
+
+		"gossip_interval_ms": n.GossipInterval.Milliseconds(),
+		"gossip_jitter_ms":   n.GossipJitter.Milliseconds(),
+		"fanout":             n.Fanout,
+		"peer_selection":     n.selector.Name(),
+		"peer_sampling":      n.PeerSampling,
+
+		"version_mode": n.VersionMode,
+
+		"gossip_mode":    n.gossipMode,
+		"merkle_root":    hex.EncodeToString(merkleRoot[:]),
+		"rumor_variant":  n.RumorVariant,
+		"rumor_k":        n.RumorK,
+		"hot_rumors":     len(n.hotRumors),
+		"dissemination":  n.Dissemination,
+		"max_delta_keys": n.MaxDeltaKeys,
+
+		"tombstone_count":    tombstones,
+		"tombstone_grace_ms": n.TombstoneGrace.Milliseconds(),
+	}
+	switch {
+	case n.swimEnabled():
+		status["failure_detector"] = FailureDetectorSWIM
+		status["incarnation"] = n.Incarnation()
+		status["members"] = n.MemberStatuses()
+	case n.phi != nil:
+		status["failure_detector"] = FailureDetectorPhi
+		status["phi_threshold"] = n.phi.config.Threshold
+		status["phi"] = n.PhiStatuses()
+	default:
+		status["failure_detector"] = FailureDetectorNone
+	}
+	if n.gossipMode == GossipModePlumtree {
+		status["plumtree"] = n.plumtreeStatusLocked()
+	}
+	switch n.PeerSampling {
+	case PeerSamplingCyclon:
+		status["view_size"] = n.ViewSize
+		status["view"] = append([]ViewEntry{}, n.view...)
+	case PeerSamplingHyParView:
+		status["active_view_size"] = n.HyParView.ActiveSize
+		status["passive_view_size"] = n.HyParView.PassiveSize
+		status["passive_view"] = append([]string{}, n.passive...)
+	}
+	status["traffic"] = n.Traffic()
+	status["rate_limit"] = n.limiter.Status()
+	if n.faults.Enabled() {
+		status["faults"] = n.FaultStatus()
+	}
+	if n.VersionMode == VersionModeVClock && entry != nil {
+		status["siblings"] = entry.Siblings
+		status["context"] = EncodeContext(siblingsContext(entry.Siblings))
 	}
+	return status
 }
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ピア選択戦略
+const (
+	PeerSelectionUniform     = "uniform"
+	PeerSelectionShuffle     = "shuffle"
+	PeerSelectionLeastRecent = "least-recent"
+	PeerSelectionLatency     = "latency"
+)
+
+// ゴシップ送信先の選択戦略
+// Selectはpeersからk個の異なるピアを選び、Observeは送信結果（所要時間とエラー）を受け取る
+type PeerSelector interface {
+	Name() string
+	Select(peers []string, k int) []string
+	Observe(peer string, latency time.Duration, err error)
+}
+
+func validPeerSelection(name string) bool {
+	switch name {
+	case PeerSelectionUniform, PeerSelectionShuffle, PeerSelectionLeastRecent, PeerSelectionLatency:
+		return true
+	}
+	return false
+}
+
+func newPeerSelector(name string) PeerSelector {
+	switch name {
+	case PeerSelectionShuffle:
+		return &shuffleSelector{}
+	case PeerSelectionLeastRecent:
+		return &leastRecentSelector{lastContact: map[string]time.Time{}}
+	case PeerSelectionLatency:
+		return &latencySelector{latency: map[string]time.Duration{}}
+	default:
+		return uniformSelector{}
+	}
+}
+
+// 選ぶ数をピア数で頭打ちにする
+func clampFanout(peers []string, k int) int {
+	if k > len(peers) {
+		return len(peers)
+	}
+	return k
+}
+
+// 一様ランダム（非復元抽出）
+type uniformSelector struct{}
+
+func (uniformSelector) Name() string { return PeerSelectionUniform }
+
+func (uniformSelector) Select(peers []string, k int) []string {
+	k = clampFanout(peers, k)
+	targets := make([]string, 0, k)
+	for _, index := range rand.Perm(len(peers))[:k] {
+		targets = append(targets, peers[index])
+	}
+	return targets
+}
+
+func (uniformSelector) Observe(string, time.Duration, error) {}
+
+// シャッフルしたピア列を順に巡回する
+// 1サイクル（列を一巡する間）に各ピアへちょうど1回ずつ送ることを保証する
+type shuffleSelector struct {
+	mu    sync.Mutex
+	order []string
+	next  int
+}
+
+func (s *shuffleSelector) Name() string { return PeerSelectionShuffle }
+
+func (s *shuffleSelector) Select(peers []string, k int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !sameMembers(s.order, peers) {
+		s.reshuffle(peers)
+	}
+
+	k = clampFanout(peers, k)
+	targets := make([]string, 0, k)
+	chosen := map[string]bool{}
+	for len(targets) < k {
+		if s.next == len(s.order) {
+			s.reshuffle(peers)
+		}
+		peer := s.order[s.next]
+		if chosen[peer] {
+			// 新しいサイクルの先頭が同じラウンドで選択済みなら後ろのピアと入れ替える
+			swap := s.next + 1
+			for chosen[s.order[swap]] {
+				swap++
+			}
+			s.order[s.next], s.order[swap] = s.order[swap], s.order[s.next]
+			peer = s.order[s.next]
+		}
+		s.next++
+		chosen[peer] = true
+		targets = append(targets, peer)
+	}
+	return targets
+}
+
+func (s *shuffleSelector) reshuffle(peers []string) {
+	s.order = append(s.order[:0], peers...)
+	rand.Shuffle(len(s.order), func(i, j int) {
+		s.order[i], s.order[j] = s.order[j], s.order[i]
+	})
+	s.next = 0
+}
+
+func (s *shuffleSelector) Observe(string, time.Duration, error) {}
+
+// 2つのピア一覧が同じ集合かどうか
+func sameMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, peer := range a {
+		set[peer] = true
+	}
+	for _, peer := range b {
+		if !set[peer] {
+			return false
+		}
+	}
+	return true
+}
+
+// 最後に送った時刻が最も古いピアを優先する（未接触のピアが最優先）
+// 同時刻のピアはランダムに並べる
+type leastRecentSelector struct {
+	mu          sync.Mutex
+	lastContact map[string]time.Time
+}
+
+func (s *leastRecentSelector) Name() string { return PeerSelectionLeastRecent }
+
+func (s *leastRecentSelector) Select(peers []string, k int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	candidates := append([]string(nil), peers...)
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return s.lastContact[candidates[i]].Before(s.lastContact[candidates[j]])
+	})
+
+	// 並列ラウンドで同じピアが続けて選ばれないよう、選択時点で接触済みとする
+	targets := candidates[:clampFanout(peers, k)]
+	now := time.Now()
+	for _, peer := range targets {
+		s.lastContact[peer] = now
+	}
+	return targets
+}
+
+func (s *leastRecentSelector) Observe(string, time.Duration, error) {}
+
+// 応答の速いピアほど選ばれやすい（重みはレイテンシの逆数）
+// レイテンシは指数移動平均で追跡し、送信失敗はペナルティ値として扱う
+type latencySelector struct {
+	mu      sync.Mutex
+	latency map[string]time.Duration
+}
+
+const (
+	latencySmoothing = 0.3
+	latencyPenalty   = time.Second
+	// 未計測のピアの初期値（まず試してもらえるよう小さめ）
+	latencyUnknown = time.Millisecond
+)
+
+func (s *latencySelector) Name() string { return PeerSelectionLatency }
+
+func (s *latencySelector) Select(peers []string, k int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	candidates := append([]string(nil), peers...)
+	k = clampFanout(peers, k)
+	targets := make([]string, 0, k)
+	// 重み付きの非復元抽出: 選んだピアを候補から外して繰り返す
+	for len(targets) < k {
+		weights := make([]float64, len(candidates))
+		total := 0.0
+		for i, peer := range candidates {
+			weights[i] = 1 / s.latencyOf(peer).Seconds()
+			total += weights[i]
+		}
+		pick := rand.Float64() * total
+		index := len(candidates) - 1
+		for i, weight := range weights {
+			if pick < weight {
+				index = i
+				break
+			}
+			pick -= weight
+		}
+		targets = append(targets, candidates[index])
+		candidates = append(candidates[:index], candidates[index+1:]...)
+	}
+	return targets
+}
+
+func (s *latencySelector) latencyOf(peer string) time.Duration {
+	if latency, ok := s.latency[peer]; ok && latency > 0 {
+		return latency
+	}
+	return latencyUnknown
+}
+
+func (s *latencySelector) Observe(peer string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		latency = latencyPenalty
+	}
+	previous, ok := s.latency[peer]
+	if !ok {
+		s.latency[peer] = latency
+		return
+	}
+	s.latency[peer] = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(previous))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// phi accrual故障検出（Hayashibara et al.、Cassandra/Akkaと同様の方式）
+// 受信したゴシップをピアからのハートビートとみなし、到着間隔の分布から
+// 「まだ次が届いていない」ことの疑わしさphiを連続値で求める
+const FailureDetectorPhi = "phi"
+
+// phiのパラメータ
+//   - Threshold: phiがこの値を超えたピアを利用不可とみなす
+//   - WindowSize: 保持する到着間隔の数
+//   - MinStdDev: 標準偏差の下限（間隔が揃いすぎてphiが急騰するのを防ぐ）
+//   - FirstHeartbeat: 最初の間隔が得られるまでの到着間隔の推定値
+type PhiConfig struct {
+	Threshold      float64
+	WindowSize     int
+	MinStdDev      time.Duration
+	FirstHeartbeat time.Duration
+}
+
+// JSON出力用のピアごとの状態
+type PhiStatus struct {
+	Phi        float64 `json:"phi"`
+	Available  bool    `json:"available"`
+	Heartbeats int64   `json:"heartbeats"`
+	MeanMs     float64 `json:"mean_interval_ms"`
+	StdDevMs   float64 `json:"stddev_ms"`
+	LastMs     int64   `json:"since_last_ms"`
+}
+
+// 1ピア分の到着間隔（ミリ秒）のスライディングウィンドウ
+type arrivalWindow struct {
+	intervals  []float64
+	last       time.Time
+	heartbeats int64
+}
+
+type phiDetector struct {
+	mu      sync.Mutex
+	config  PhiConfig
+	windows map[string]*arrivalWindow
+}
+
+func newPhiDetector(config PhiConfig) *phiDetector {
+	return &phiDetector{config: config, windows: map[string]*arrivalWindow{}}
+}
+
+// ピア（ノードID）からのハートビートを記録する
+func (d *phiDetector) heartbeat(peer string, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window, ok := d.windows[peer]
+	if !ok {
+		// 最初の間隔は推定値で埋めておく（平均FirstHeartbeat、標準偏差はその1/4）
+		estimate := float64(d.config.FirstHeartbeat.Milliseconds())
+		d.windows[peer] = &arrivalWindow{
+			intervals:  []float64{estimate - estimate/4, estimate + estimate/4},
+			last:       now,
+			heartbeats: 1,
+		}
+		return
+	}
+	window.intervals = append(window.intervals, float64(now.Sub(window.last).Milliseconds()))
+	if len(window.intervals) > d.config.WindowSize {
+		window.intervals = window.intervals[len(window.intervals)-d.config.WindowSize:]
+	}
+	window.last = now
+	window.heartbeats++
+}
+
+func (w *arrivalWindow) stats(minStdDev float64) (mean, stddev float64) {
+	for _, interval := range w.intervals {
+		mean += interval
+	}
+	mean /= float64(len(w.intervals))
+	for _, interval := range w.intervals {
+		stddev += (interval - mean) * (interval - mean)
+	}
+	stddev = math.Sqrt(stddev / float64(len(w.intervals)))
+	return mean, math.Max(stddev, minStdDev)
+}
+
+// 正規分布の上側確率をロジスティック関数で近似したphi（Akkaの実装と同じ近似式）
+func phiOf(elapsed, mean, stddev float64) float64 {
+	y := (elapsed - mean) / stddev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1 + e))
+	}
+	return -math.Log10(1 - 1/(1+e))
+}
+
+// 全ピアのphi（ノードID順ではなくmapで返す）
+func (d *phiDetector) statuses(now time.Time) map[string]PhiStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	minStdDev := float64(d.config.MinStdDev.Milliseconds())
+	statuses := make(map[string]PhiStatus, len(d.windows))
+	for peer, window := range d.windows {
+		mean, stddev := window.stats(minStdDev)
+		elapsed := now.Sub(window.last)
+		phi := phiOf(float64(elapsed.Milliseconds()), mean, stddev)
+		statuses[peer] = PhiStatus{
+			Phi:        math.Round(phi*100) / 100,
+			Available:  phi < d.config.Threshold,
+			Heartbeats: window.heartbeats,
+			MeanMs:     math.Round(mean),
+			StdDevMs:   math.Round(stddev),
+			LastMs:     elapsed.Milliseconds(),
+		}
+	}
+	return statuses
+}
+
+// 受信したゴシップの送信元（ノードID）をハートビートとして記録する
+func (n *Node) recordHeartbeat(from string) {
+	if n.phi == nil || from == "" || from == n.ID {
+		return
+	}
+	n.phi.heartbeat(from, time.Now())
+}
+
+// ピアごとのphi（phi検出が無効ならnil）
+func (n *Node) PhiStatuses() map[string]PhiStatus {
+	if n.phi == nil {
+		return nil
+	}
+	return n.phi.statuses(time.Now())
+}
+
+// phiが閾値を超えているピア（ノードID順）
+func (n *Node) UnavailablePeers() []string {
+	var peers []string
+	for peer, status := range n.PhiStatuses() {
+		if !status.Available {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Plumtree（Leitão et al.）: eagerピアへは本体を、lazyピアへはIHAVEだけを送り、
+// 重複を受け取ったらPRUNEでlazyへ、欠落に気づいたらGRAFTでeagerへ戻して
+// ピア間に全域木を作る
+const GossipModePlumtree = "plumtree"
+
+// Plumtreeのメッセージ種別
+const (
+	PlumtreeGossip = "GOSSIP"
+	PlumtreeIHave  = "IHAVE"
+	PlumtreePrune  = "PRUNE"
+	PlumtreeGraft  = "GRAFT"
+)
+
+const (
+	// IHAVEを受け取ってから本体を待つ時間（過ぎたらGRAFTする）
+	plumtreeGraftTimeout = 500 * time.Millisecond
+	// 受信済みメッセージを保持する時間（GRAFTへの応答と重複検出用）
+	plumtreeCacheTTL = time.Minute
+)
+
+// GOSSIPは1つの更新（KVエントリかCRDT状態）を運ぶ
+type PlumtreeMessage struct {
+	Type    string       `json:"type"`
+	From    string       `json:"from"`
+	ID      string       `json:"id,omitempty"`
+	IDs     []string     `json:"ids,omitempty"`
+	Round   int          `json:"round,omitempty"`
+	Entries []Entry      `json:"entries,omitempty"`
+	States  []StateEntry `json:"states,omitempty"`
+}
+
+// 送受信の統計（Redundantは重複して届いたGOSSIPの数）
+type PlumtreeStats struct {
+	GossipSent     int64 `json:"gossip_sent"`
+	GossipReceived int64 `json:"gossip_received"`
+	Redundant      int64 `json:"redundant"`
+	IHaveSent      int64 `json:"ihave_sent"`
+	PruneSent      int64 `json:"prune_sent"`
+	GraftSent      int64 `json:"graft_sent"`
+}
+
+type plumtreeCached struct {
+	message    PlumtreeMessage
+	receivedAt time.Time
+}
+
+// 本体待ちのメッセージ（IHAVEを送ってきたピア順）
+type plumtreeMissing struct {
+	announcers []string
+	timer      *time.Timer
+}
+
+// ノードごとのPlumtreeの状態
+// Peersのうちlazyに含まれないピアがeagerピア（メンバーシップの変化にそのまま追従する）
+type plumtreeState struct {
+	mu       sync.Mutex
+	lazy     map[string]bool
+	received map[string]plumtreeCached
+	missing  map[string]*plumtreeMissing
+	// ローカル書き込みのうち未送信のもの（item key）
+	pending map[string]bool
+	stats   PlumtreeStats
+}
+
+func newPlumtreeState() *plumtreeState {
+	return &plumtreeState{
+		lazy:     map[string]bool{},
+		received: map[string]plumtreeCached{},
+		missing:  map[string]*plumtreeMissing{},
+		pending:  map[string]bool{},
+	}
+}
+
+// ローカル書き込みを次のラウンドで配信する（plumtreeモードのときのみ）
+// 呼び出し側でn.muを保持していること
+func (n *Node) queueBroadcast(item string) {
+	if n.gossipMode != GossipModePlumtree {
+		return
+	}
+	n.plumtree.mu.Lock()
+	n.plumtree.pending[item] = true
+	n.plumtree.mu.Unlock()
+}
+
+// メッセージIDはitem keyとその内容のバージョンから作る
+func plumtreeMessageID(message PlumtreeMessage) string {
+	for _, entry := range message.Entries {
+		return fmt.Sprintf("%s%s@%d/%s", merkleEntryPrefix, entry.Key, entry.Version.Clock, entry.Version.NodeID)
+	}
+	for _, state := range message.States {
+		sum := sha256.Sum256(state.Data)
+		return fmt.Sprintf("%s%s@%s", merkleStatePrefix, state.Key, hex.EncodeToString(sum[:8]))
+	}
+	return ""
+}
+
+// item keyの現在の内容をGOSSIPメッセージにする
+func (n *Node) plumtreePayload(item string) (PlumtreeMessage, bool) {
+	message := PlumtreeMessage{Type: PlumtreeGossip, From: n.Address}
+	if key, ok := strings.CutPrefix(item, merkleEntryPrefix); ok {
+		message.Entries = n.entriesFor([]string{key})
+	} else if key, ok := strings.CutPrefix(item, merkleStatePrefix); ok {
+		message.States = n.stateEntriesFor([]string{key})
+	}
+	if len(message.Entries) == 0 && len(message.States) == 0 {
+		return message, false
+	}
+	message.ID = plumtreeMessageID(message)
+	return message, true
+}
+
+// eagerピアとlazyピア（exceptを除く）
+func (n *Node) plumtreePeers(except string) (eager, lazy []string) {
+	n.mu.RLock()
+	peers := append([]string(nil), n.Peers...)
+	n.mu.RUnlock()
+	return n.plumtree.split(peers, except)
+}
+
+// peersをeagerとlazyに分ける
+func (p *plumtreeState) split(peers []string, except string) (eager, lazy []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, peer := range peers {
+		if peer == except {
+			continue
+		}
+		if p.lazy[peer] {
+			lazy = append(lazy, peer)
+		} else {
+			eager = append(eager, peer)
+		}
+	}
+	return eager, lazy
+}
+
+// 未送信のローカル書き込みがあるか
+func (n *Node) hasPendingBroadcasts() bool {
+	n.plumtree.mu.Lock()
+	defer n.plumtree.mu.Unlock()
+	return len(n.plumtree.pending) > 0
+}
+
+// 1ラウンド: 未送信のローカル書き込みをeagerピアへ本体、lazyピアへIHAVEとして送る
+// 送信先（eagerとlazy）へ並列に送って完了を待ち、送信先の一覧と送信先ごとの結果（SendError）を返す
+func (n *Node) plumtreeRound() ([]string, error) {
+	n.plumtree.mu.Lock()
+	items := make([]string, 0, len(n.plumtree.pending))
+	for item := range n.plumtree.pending {
+		items = append(items, item)
+	}
+	n.plumtree.pending = map[string]bool{}
+	n.plumtree.mu.Unlock()
+	if len(items) == 0 {
+		return nil, nil
+	}
+	sort.Strings(items)
+
+	var messages []PlumtreeMessage
+	for _, item := range items {
+		if message, ok := n.plumtreePayload(item); ok {
+			n.rememberPlumtree(message)
+			messages = append(messages, message)
+		}
+	}
+
+	eager, lazy := n.plumtreePeers("")
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+	targets := append(append([]string(nil), eager...), lazy...)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(targets))
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			if i >= len(eager) {
+				errs[i] = n.postPlumtreeControl(target, PlumtreeMessage{Type: PlumtreeIHave, From: n.Address, IDs: ids})
+				return
+			}
+			for _, message := range messages {
+				if errs[i] = n.postPlumtreeGossip(target, message); errs[i] != nil {
+					return
+				}
+			}
+		}(i, target)
+	}
+	wg.Wait()
+
+	log.Printf("[%s] Plumtree broadcast %d messages: eager %v, lazy %v", n.ID, len(messages), eager, lazy)
+	return targets, newSendError(targets, errs)
+}
+
+// 受信済みとして記録する（古いものはここで捨てる）
+// 既に受信済みだった場合はfalseを返す
+func (n *Node) rememberPlumtree(message PlumtreeMessage) bool {
+	now := time.Now()
+	n.plumtree.mu.Lock()
+	defer n.plumtree.mu.Unlock()
+	if _, ok := n.plumtree.received[message.ID]; ok {
+		return false
+	}
+	for id, cached := range n.plumtree.received {
+		if now.Sub(cached.receivedAt) > plumtreeCacheTTL {
+			delete(n.plumtree.received, id)
+		}
+	}
+	n.plumtree.received[message.ID] = plumtreeCached{message: message, receivedAt: now}
+	if missing, ok := n.plumtree.missing[message.ID]; ok {
+		missing.timer.Stop()
+		delete(n.plumtree.missing, message.ID)
+	}
+	return true
+}
+
+// 本体を非同期に送る（受信したメッセージの転送用）
+func (n *Node) sendPlumtreeGossip(target string, message PlumtreeMessage) {
+	n.spawn(func() { n.postPlumtreeGossip(target, message) })
+}
+
+// 本体を送り、完了を待つ（失敗したピアは故障として扱う）
+func (n *Node) postPlumtreeGossip(target string, message PlumtreeMessage) error {
+	message.From = n.Address
+	n.plumtree.mu.Lock()
+	n.plumtree.stats.GossipSent++
+	n.plumtree.mu.Unlock()
+	size, err := n.postJSON(target, "/plumtree", message, nil)
+	if err != nil {
+		log.Printf("[%s] Plumtree gossip to %s failed: %v", n.ID, target, err)
+		n.handlePeerFailure(target)
+		return err
+	}
+	n.recordSent(size, trafficDelta)
+	return nil
+}
+
+// IHAVE/PRUNEを非同期に送る
+func (n *Node) sendPlumtreeControl(target string, message PlumtreeMessage) {
+	n.spawn(func() { n.postPlumtreeControl(target, message) })
+}
+
+// IHAVE/PRUNEを送り、完了を待つ
+func (n *Node) postPlumtreeControl(target string, message PlumtreeMessage) error {
+	n.plumtree.mu.Lock()
+	switch message.Type {
+	case PlumtreeIHave:
+		n.plumtree.stats.IHaveSent++
+	case PlumtreePrune:
+		n.plumtree.stats.PruneSent++
+	}
+	n.plumtree.mu.Unlock()
+	size, err := n.postJSON(target, "/plumtree", message, nil)
+	if err != nil {
+		log.Printf("[%s] Plumtree %s to %s failed: %v", n.ID, message.Type, target, err)
+		return err
+	}
+	n.recordSent(size, trafficDigest)
+	return nil
+}
+
+// Plumtreeメッセージ受信処理（GRAFTに対しては本体を返す）
+func (n *Node) HandlePlumtree(message PlumtreeMessage) PlumtreeMessage {
+	switch message.Type {
+	case PlumtreeGossip:
+		n.receivePlumtreeGossip(message)
+	case PlumtreeIHave:
+		n.receiveIHave(message)
+	case PlumtreePrune:
+		n.setPlumtreeLazy(message.From, true)
+	case PlumtreeGraft:
+		n.setPlumtreeLazy(message.From, false)
+		n.plumtree.mu.Lock()
+		cached, ok := n.plumtree.received[message.ID]
+		n.plumtree.mu.Unlock()
+		if ok {
+			reply := cached.message
+			reply.From = n.Address
+			return reply
+		}
+	}
+	return PlumtreeMessage{}
+}
+
+// GOSSIP: 初めてなら取り込んでeagerピアへ転送・lazyピアへIHAVE、
+// 重複なら送信元をlazyへ移してPRUNEを返す
+func (n *Node) receivePlumtreeGossip(message PlumtreeMessage) {
+	if message.ID == "" {
+		return
+	}
+	duplicate := !n.rememberPlumtree(message)
+	n.plumtree.mu.Lock()
+	n.plumtree.stats.GossipReceived++
+	if duplicate {
+		n.plumtree.stats.Redundant++
+	}
+	n.plumtree.mu.Unlock()
+
+	if duplicate {
+		n.setPlumtreeLazy(message.From, true)
+		n.sendPlumtreeControl(message.From, PlumtreeMessage{Type: PlumtreePrune, From: n.Address})
+		return
+	}
+
+	n.setPlumtreeLazy(message.From, false)
+	for _, entry := range message.Entries {
+		n.MergeEntry(entry)
+	}
+	for _, state := range message.States {
+		if _, err := n.MergeStateEntry(state); err != nil {
+			log.Printf("[%s] Failed to merge state '%s' from %s: %v", n.ID, state.Key, message.From, err)
+		}
+	}
+
+	eager, lazy := n.plumtreePeers(message.From)
+	forward := message
+	forward.Round++
+	for _, peer := range eager {
+		n.sendPlumtreeGossip(peer, forward)
+	}
+	for _, peer := range lazy {
+		n.sendPlumtreeControl(peer, PlumtreeMessage{Type: PlumtreeIHave, From: n.Address, IDs: []string{message.ID}})
+	}
+}
+
+// IHAVE: 未受信のIDについてタイマーを起動し、期限までに本体が届かなければGRAFTする
+func (n *Node) receiveIHave(message PlumtreeMessage) {
+	n.plumtree.mu.Lock()
+	defer n.plumtree.mu.Unlock()
+	for _, id := range message.IDs {
+		if _, ok := n.plumtree.received[id]; ok {
+			continue
+		}
+		missing, ok := n.plumtree.missing[id]
+		if !ok {
+			missing = &plumtreeMissing{}
+			n.plumtree.missing[id] = missing
+			missing.timer = n.afterGraftTimeout(id)
+		}
+		if !containsString(missing.announcers, message.From) {
+			missing.announcers = append(missing.announcers, message.From)
+		}
+	}
+}
+
+// 本体が届かないままタイムアウトしたらgraftする
+// graftもspawnで実行し、停止後には送らない
+func (n *Node) afterGraftTimeout(id string) *time.Timer {
+	return time.AfterFunc(plumtreeGraftTimeout, func() { n.spawn(func() { n.graft(id) }) })
+}
+
+// 最初にIHAVEを送ってきたピアをeagerへ戻して本体を要求する
+// 取得できなければ次のピアで再試行する
+func (n *Node) graft(id string) {
+	n.plumtree.mu.Lock()
+	missing, ok := n.plumtree.missing[id]
+	if !ok || len(missing.announcers) == 0 {
+		delete(n.plumtree.missing, id)
+		n.plumtree.mu.Unlock()
+		return
+	}
+	target := missing.announcers[0]
+	missing.announcers = missing.announcers[1:]
+	missing.timer = n.afterGraftTimeout(id)
+	n.plumtree.stats.GraftSent++
+	n.plumtree.mu.Unlock()
+
+	n.setPlumtreeLazy(target, false)
+	var reply PlumtreeMessage
+	size, err := n.postJSON(target, "/plumtree", PlumtreeMessage{Type: PlumtreeGraft, From: n.Address, ID: id}, &reply)
+	if err != nil {
+		log.Printf("[%s] Plumtree graft from %s failed: %v", n.ID, target, err)
+		return
+	}
+	n.recordSent(size, trafficDigest)
+	if reply.Type == PlumtreeGossip {
+		log.Printf("[%s] Grafted %s from %s", n.ID, id, target)
+		n.receivePlumtreeGossip(reply)
+	}
+}
+
+func (n *Node) setPlumtreeLazy(peer string, lazy bool) {
+	n.plumtree.mu.Lock()
+	defer n.plumtree.mu.Unlock()
+	if lazy {
+		n.plumtree.lazy[peer] = true
+	} else {
+		delete(n.plumtree.lazy, peer)
+	}
+}
+
+// JSON出力用の状態
+type PlumtreeStatus struct {
+	Eager []string      `json:"eager"`
+	Lazy  []string      `json:"lazy"`
+	Stats PlumtreeStats `json:"stats"`
+}
+
+// eager/lazyピアと統計（呼び出し側でn.muを保持していること）
+func (n *Node) plumtreeStatusLocked() PlumtreeStatus {
+	eager, lazy := n.plumtree.split(n.Peers, "")
+	n.plumtree.mu.Lock()
+	defer n.plumtree.mu.Unlock()
+	return PlumtreeStatus{Eager: eager, Lazy: lazy, Stats: n.plumtree.stats}
+}
+
+// eager/lazyピアと統計
+func (n *Node) PlumtreeStatus() PlumtreeStatus {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.plumtreeStatusLocked()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("gossip rate limit exceeded")
+
+// 送信ゴシップのトークンバケット（Riakのgossip_limit {45, 10000} に相当）
+// 期間ごとにトークンを容量まで補充する（Riakのreset_tokensと同じく一括補充）
+// nilのバケットは無制限として扱う
+type TokenBucket struct {
+	mu       sync.Mutex
+	capacity int
+	period   time.Duration
+	tokens   int
+	resetAt  time.Time
+	dropped  int64
+}
+
+// capacityが0以下の場合は無制限（nil）を返す
+func NewTokenBucket(capacity int, period time.Duration) *TokenBucket {
+	if capacity <= 0 || period <= 0 {
+		return nil
+	}
+	return &TokenBucket{
+		capacity: capacity,
+		period:   period,
+		tokens:   capacity,
+		resetAt:  time.Now().Add(period),
+	}
+}
+
+// 呼び出し側でロックを保持していること
+func (b *TokenBucket) refill() {
+	if now := time.Now(); !now.Before(b.resetAt) {
+		b.tokens = b.capacity
+		b.resetAt = now.Add(b.period)
+	}
+}
+
+// トークンを1つ消費する。枯渇していればfalseを返し、破棄数を数える
+func (b *TokenBucket) Take() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens == 0 {
+		b.dropped++
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// JSON出力用の状態
+type RateLimitStatus struct {
+	Enabled         bool  `json:"enabled"`
+	Capacity        int   `json:"capacity"`
+	PeriodMs        int64 `json:"period_ms"`
+	TokensRemaining int   `json:"tokens_remaining"`
+	DroppedSends    int64 `json:"dropped_sends"`
+}
+
+func (b *TokenBucket) Status() RateLimitStatus {
+	if b == nil {
+		return RateLimitStatus{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return RateLimitStatus{
+		Enabled:         true,
+		Capacity:        b.capacity,
+		PeriodMs:        b.period.Milliseconds(),
+		TokensRemaining: b.tokens,
+		DroppedSends:    b.dropped,
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// トリガーの種類（riak_core_gossipの送信方式に対応）
+const (
+	TriggerRandom          = "random"           // random_gossip/1
+	TriggerRecursive       = "recursive"        // recursive_gossip/1
+	TriggerRandomRecursive = "random-recursive" // random_recursive_gossip/1
+)
+
+// 自ノードを含むメンバー一覧（ソート済み）
+// ゴシップで知ったメンバーシップリストの参加中のメンバーを使うため、
+// 隣接ノードに限らずクラスター全体で木を作る（まだリストにないピアも含める）
+func (n *Node) members() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	seen := map[string]bool{n.Address: true}
+	members := []string{n.Address}
+	for address, record := range n.membership {
+		if record.Status == MembershipJoined && !seen[address] {
+			seen[address] = true
+			members = append(members, address)
+		}
+	}
+	for _, peer := range n.Peers {
+		if record, ok := n.membership[peer]; (!ok || record.Status == MembershipJoined) && !seen[peer] {
+			seen[peer] = true
+			members = append(members, peer)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// riak_core_util:build_tree/3 相当の二分木
+// ソート済みメンバーをrootが先頭になるよう回転し、位置iの子を位置2i+1と2i+2とする
+func buildTree(members []string, root string) map[string][]string {
+	start := -1
+	for i, member := range members {
+		if member == root {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return map[string][]string{}
+	}
+
+	ordered := append(append([]string{}, members[start:]...), members[:start]...)
+	tree := make(map[string][]string, len(ordered))
+	for i, member := range ordered {
+		var children []string
+		for _, c := range []int{2*i + 1, 2*i + 2} {
+			if c < len(ordered) {
+				children = append(children, ordered[c])
+			}
+		}
+		tree[member] = children
+	}
+	return tree
+}
+
+// recursive_gossip: 自ノードを根とする二分木の子へ送信する
+// 受信したノードは同じ木の自分の子へ転送する
+func (n *Node) RecursiveGossip() ([]string, error) {
+	if n.HasLeft() {
+		return nil, ErrNodeLeft
+	}
+	return n.gossipTree(n.Address, 0)
+}
+
+// random_recursive_gossip: ランダムに選んだメンバーを根とする木で拡散する
+// 根が自ノードでなければ根へ送り、根から木に沿って転送させる
+func (n *Node) RandomRecursiveGossip() ([]string, error) {
+	if n.HasLeft() {
+		return nil, ErrNodeLeft
+	}
+	members := n.members()
+	root := members[rand.Intn(len(members))]
+	if root == n.Address {
+		return n.gossipTree(root, 0)
+	}
+	if err := n.sendTreeMessage(root, root, 0); err != nil {
+		return []string{root}, newSendError([]string{root}, []error{err})
+	}
+	log.Printf("[%s] Random recursive gossip via root %s", n.ID, root)
+	return []string{root}, nil
+}
+
+// rootの木における自ノードの子へ並列に送信する
+func (n *Node) gossipTree(root string, hops int) ([]string, error) {
+	members := n.members()
+	// 各ノードのメンバー一覧が食い違っても転送が循環しないよう、ホップ数で打ち切る
+	if hops >= len(members) {
+		return nil, nil
+	}
+	children := buildTree(members, root)[n.Address]
+	if len(children) == 0 {
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(children))
+	for i, child := range children {
+		wg.Add(1)
+		go func(i int, child string) {
+			defer wg.Done()
+			errs[i] = n.sendTreeMessage(child, root, hops+1)
+		}(i, child)
+	}
+	wg.Wait()
+
+	if err := newSendError(children, errs); err != nil {
+		return children, err
+	}
+	log.Printf("[%s] Recursive gossip (root %s, hop %d) to %v", n.ID, root, hops, children)
+	return children, nil
+}
+
+// 木に沿った転送用の全状態メッセージを送る（転送もレート制限の対象）
+func (n *Node) sendTreeMessage(target, root string, hops int) error {
+	if !n.limiter.Take() {
+		return ErrRateLimited
+	}
+	message := GossipMessage{
+		From:      n.ID,
+		Entries:   n.Entries(),
+		States:    n.StateEntries(),
+		Timestamp: time.Now().Unix(),
+		TreeRoot:  root,
+		TreeHops:  hops,
+	}
+	size, err := n.sendHTTPMessage(target, message)
+	if err != nil {
+		return err
+	}
+	n.recordSent(size, trafficFull)
+	n.recordTombstoneAcks(target, message.Entries)
+	return nil
+}
+
+// 木に沿ったメッセージを受信したら、自分の子へ非同期に転送する
+func (n *Node) forwardTreeMessage(msg GossipMessage) {
+	if msg.TreeRoot == "" {
+		return
+	}
+	n.spawn(func() {
+		if _, err := n.gossipTree(msg.TreeRoot, msg.TreeHops); err != nil {
+			log.Printf("[%s] Recursive gossip forward failed: %v", n.ID, err)
+		}
+	})
+}
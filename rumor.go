@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rumor mongeringで関心を失う条件（Demers et al.のloss of interest）
+const (
+	RumorVariantCounter = "counter" // 不要な送信がk回に達したら停止
+	RumorVariantCoin    = "coin"    // 不要な送信のたびに確率1/kで停止
+)
+
+// 拡散中（hot）のrumor
+type rumor struct {
+	Unnecessary int // 相手が既に知っていた回数
+}
+
+// ゴシップメッセージへの応答
+type GossipAck struct {
+	Status string   `json:"status"`
+	Known  []string `json:"known,omitempty"` // rumorのうち受信側が既に知っていた項目（kv/・crdt/付きのキー）
+}
+
+// KVキー・CRDTキーの更新をhotなrumorとして記録する（rumorモードのときのみ）
+// itemはMerkle木と同じくkv/またはcrdt/を前置したキー
+// 呼び出し側でロックを保持していること
+func (n *Node) markHotRumor(item string) {
+	if n.gossipMode != GossipModeRumor {
+		return
+	}
+	n.hotRumors[item] = &rumor{}
+}
+
+// 拡散中のrumorがあるか
+func (n *Node) HasHotRumors() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.hotRumors) > 0
+}
+
+// 拡散中のrumorの項目（kv/・crdt/付きのキー、ソート済み）
+func (n *Node) HotRumors() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	keys := make([]string, 0, len(n.hotRumors))
+	for key := range n.hotRumors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rumor mongering: hotなrumorだけをランダムなピアへ送り、
+// 相手が既に知っていたrumorについては関心を失うかを判定する
+// 関心を失った後もtombstoneを削除できるよう、相手の確認がまだないtombstoneも一緒に送る
+func (n *Node) rumorGossip(target string) error {
+	var keys, stateKeys []string
+	for _, item := range n.HotRumors() {
+		if key, ok := strings.CutPrefix(item, merkleStatePrefix); ok {
+			stateKeys = append(stateKeys, key)
+		} else {
+			keys = append(keys, strings.TrimPrefix(item, merkleEntryPrefix))
+		}
+	}
+	for _, key := range n.unackedTombstones(target) {
+		if !containsString(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 && len(stateKeys) == 0 {
+		return nil
+	}
+	message := GossipMessage{
+		From:       n.ID,
+		Entries:    n.entriesFor(keys),
+		States:     n.stateEntriesFor(stateKeys),
+		Timestamp:  time.Now().Unix(),
+		Rumor:      true,
+		Members:    n.swimPiggyback(),
+		Membership: n.Membership(),
+	}
+
+	var ack GossipAck
+	size, err := n.postJSON(target, "/gossip", message, &ack)
+	if err != nil {
+		return err
+	}
+	n.recordSent(size, trafficFull)
+	n.recordTombstoneAcks(target, message.Entries)
+
+	removed := n.loseInterest(ack.Known)
+	log.Printf("[%s] Spread %d rumors to %s: %d already known, %d lost interest",
+		n.ID, len(message.Entries)+len(message.States), target, len(ack.Known), removed)
+	return nil
+}
+
+// 相手が既に知っていたrumorについてloss of interestを適用する
+func (n *Node) loseInterest(known []string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	removed := 0
+	for _, key := range known {
+		r, ok := n.hotRumors[key]
+		if !ok {
+			continue
+		}
+		r.Unnecessary++
+
+		lose := false
+		switch n.RumorVariant {
+		case RumorVariantCoin:
+			lose = rand.Intn(n.RumorK) == 0
+		default:
+			lose = r.Unnecessary >= n.RumorK
+		}
+		if lose {
+			delete(n.hotRumors, key)
+			removed++
+		}
+	}
+	return removed
+}
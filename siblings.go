@@ -0,0 +1,81 @@
+package main
+
+import "sort"
+
+// 並行書き込みで生じた値の候補（Riakのsiblingに相当）
+type Sibling struct {
+	Value   string      `json:"value"`
+	Clock   VectorClock `json:"clock"`
+	Version Version     `json:"version"`
+	Deleted bool        `json:"deleted,omitempty"`
+}
+
+// siblingからエントリを組み立てる
+// Versionは最も新しいsibling、Valueは削除されていない最も新しいsiblingを代表値とする
+// 全siblingが削除済みの場合のみエントリをtombstoneとする
+func entryFromSiblings(key string, siblings []Sibling) Entry {
+	sortSiblings(siblings)
+	entry := Entry{Key: key, Siblings: siblings, Deleted: true}
+	if len(siblings) > 0 {
+		entry.Version = siblings[0].Version
+	}
+	for _, s := range siblings {
+		if !s.Deleted {
+			entry.Value = s.Value
+			entry.Deleted = false
+			break
+		}
+	}
+	return entry
+}
+
+// 全siblingを読んだことを表すcontext（次の/setで渡すと競合を解消できる）
+func siblingsContext(siblings []Sibling) VectorClock {
+	context := VectorClock{}
+	for _, s := range siblings {
+		context = context.Merge(s.Clock)
+	}
+	return context
+}
+
+// 他のsiblingに支配されるもの・重複を取り除く
+func reconcileSiblings(candidates []Sibling) []Sibling {
+	var result []Sibling
+	for i, s := range candidates {
+		dominated := false
+		for j, other := range candidates {
+			if i == j {
+				continue
+			}
+			ordering := s.Clock.Compare(other.Clock)
+			if ordering == ClockBefore || (ordering == ClockEqual && j < i) {
+				dominated = true
+				break
+			}
+		}
+		if !dominated {
+			result = append(result, s)
+		}
+	}
+	sortSiblings(result)
+	return result
+}
+
+// バージョンの新しい順に並べる（ノード間で表示順を揃えるため）
+func sortSiblings(siblings []Sibling) {
+	sort.Slice(siblings, func(i, j int) bool {
+		return siblings[i].Version.NewerThan(siblings[j].Version)
+	})
+}
+
+func sameSiblings(a, b []Sibling) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Clock.Compare(b[i].Clock) != ClockEqual {
+			return false
+		}
+	}
+	return true
+}
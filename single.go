@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// 起動モード
+//   - cluster: 全ノードを1プロセス内のgoroutineとして起動し、管理サーバーも動かす（従来の動作）
+//   - single: 1プロセス1ノード（cmd/gossip-launcherから複数起動する）
+//   - admin: 管理サーバーだけを起動し、シードからメンバーを辿る
+const (
+	ModeCluster = "cluster"
+	ModeSingle  = "single"
+	ModeAdmin   = "admin"
+)
+
+const (
+	// シードへの参加を試みる回数と間隔（シードのプロセスがまだ起動していない場合に備える）
+	seedJoinAttempts = 50
+	seedJoinBackoff  = 200 * time.Millisecond
+)
+
+// カンマ区切りのアドレス一覧（空要素は除く）
+func splitAddresses(list string) []string {
+	var addresses []string
+	for _, address := range strings.Split(list, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// 1ノードだけを起動し、ctxがキャンセルされてノードが停止するまでブロックする
+// peersは初期ピア、seedsは参加時にメンバーシップリストを交換する相手
+func runSingleNode(ctx context.Context, id, listen string, peers, seeds []string, config NodeConfig) error {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+
+	node := createNode(id, listen, peers, config)
+	nodesMu.Lock()
+	allNodes = []*Node{node}
+	nodesMu.Unlock()
+
+	node.Start(ctx, listener)
+	if len(seeds) > 0 {
+		node.spawn(func() { node.joinSeeds(seeds) })
+	}
+	return node.Wait()
+}
+
+// いずれかのシードから参加できるまで、シードを順に試す
+func (n *Node) joinSeeds(seeds []string) {
+	for attempt := 0; attempt < seedJoinAttempts; attempt++ {
+		for _, seed := range seeds {
+			if seed == n.Address {
+				continue
+			}
+			if err := n.JoinCluster(seed); err == nil {
+				return
+			}
+		}
+		if !n.sleep(seedJoinBackoff) {
+			return
+		}
+	}
+	log.Printf("[%s] Failed to join via seeds %v", n.ID, seeds)
+}
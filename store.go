@@ -0,0 +1,228 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// キー未指定の /set・/status が扱うキー（単一値時代との互換用）
+const DefaultKey = "default"
+
+// キーごとのバージョン付きエントリ
+type Entry struct {
+	Key     string  `json:"key"`
+	Value   string  `json:"value"`
+	Version Version `json:"version"`
+
+	// 削除済みを表すtombstone（通常の値と同様にゴシップされる）
+	Deleted bool `json:"deleted,omitempty"`
+
+	// vclockモードでのみ使用
+	Siblings []Sibling `json:"siblings,omitempty"`
+
+	// tombstoneが作られた時刻（UnixMilli）
+	// GCの猶予期間は削除したノードでの時刻から数え、受信のたびに延ばさない
+	DeletedAt int64 `json:"deleted_at,omitempty"`
+
+	// tombstoneのGC用（ローカルのみ・ゴシップされない）
+	tombstoneAcks map[string]bool
+}
+
+// 起動時に各ノードが持つ初期エントリ
+// 全ノードで同じ内容になるよう、バージョンはゼロ値とする
+func newInitialEntry(key, value, versionMode string) *Entry {
+	entry := &Entry{Key: key, Value: value}
+	if versionMode == VersionModeVClock {
+		entry.Siblings = []Sibling{{Value: value, Clock: VectorClock{}}}
+	}
+	return entry
+}
+
+// 呼び出し元へ渡すためのコピー
+func (e *Entry) copy() Entry {
+	c := *e
+	c.Siblings = append([]Sibling(nil), e.Siblings...)
+	c.tombstoneAcks = nil
+	return c
+}
+
+// thread-safeなキーの取得（tombstoneは存在しない扱い）
+func (n *Node) Get(key string) (Entry, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	entry, ok := n.Store[key]
+	if !ok || entry.Deleted {
+		return Entry{Key: key}, false
+	}
+	return entry.copy(), true
+}
+
+// thread-safeなキーの更新（ローカル書き込み）
+// Lamportクロックを進めて新しいバージョンを付与する
+// vclockモードでは、contextが支配するsiblingを置き換え、並行なsiblingは残す
+// lwwモードではcontextは無視される
+func (n *Node) Set(key, value string, context VectorClock) Version {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.writeLocked(key, value, false, context)
+}
+
+// thread-safeなキーの削除（ローカル書き込み）
+// エントリはtombstoneに置き換えられ、ゴシップで他ノードへ伝搬する
+// vclockモードでは手元の全siblingを読んだものとして削除する
+func (n *Node) Delete(key string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	current, ok := n.Store[key]
+	if !ok || current.Deleted {
+		return false
+	}
+	n.writeLocked(key, "", true, siblingsContext(current.Siblings))
+	return true
+}
+
+// 呼び出し側でロックを保持していること
+func (n *Node) writeLocked(key, value string, deleted bool, context VectorClock) Version {
+	for _, counter := range context {
+		if counter > n.Clock {
+			n.Clock = counter
+		}
+	}
+	n.Clock++
+	version := Version{Clock: n.Clock, NodeID: n.ID}
+	defer n.queueBroadcast(merkleEntryPrefix + key)
+
+	if n.VersionMode != VersionModeVClock {
+		n.applyEntry(Entry{Key: key, Value: value, Version: version, Deleted: deleted})
+		return version
+	}
+
+	clock := context.Copy()
+	clock[n.ID] = n.Clock
+	siblings := []Sibling{{Value: value, Clock: clock, Version: version, Deleted: deleted}}
+	if current, ok := n.Store[key]; ok {
+		for _, s := range current.Siblings {
+			if s.Clock.Compare(clock) == ClockConcurrent {
+				siblings = append(siblings, s)
+			}
+		}
+	}
+	n.applyEntry(entryFromSiblings(key, siblings))
+	return version
+}
+
+// 保持しているキーの一覧（ソート済み・tombstoneを除く）
+func (n *Node) Keys() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	keys := make([]string, 0, len(n.Store))
+	for key, entry := range n.Store {
+		if !entry.Deleted {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 全エントリのスナップショット（キー順・tombstoneを含む）
+func (n *Node) Entries() []Entry {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	entries := make([]Entry, 0, len(n.Store))
+	for _, entry := range n.Store {
+		entries = append(entries, entry.copy())
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// リモートから届いたエントリのマージ
+// lwwモードでは新しいバージョンのみ採用し、vclockモードではsiblingを統合する
+// 状態が変化したかを返す
+func (n *Node) MergeEntry(remote Entry) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.mergeEntryLocked(remote)
+}
+
+// 呼び出し側でロックを保持していること
+func (n *Node) mergeEntryLocked(remote Entry) bool {
+	n.observeClock(remote.Version.Clock)
+	for _, s := range remote.Siblings {
+		n.observeClock(s.Version.Clock)
+	}
+
+	current, exists := n.Store[remote.Key]
+
+	// GC済みのtombstone以前のバージョンは、まだGCしていないピアから届いても受け入れない
+	if purged, ok := n.purged[remote.Key]; ok && !exists && !remote.Version.NewerThan(purged) {
+		return false
+	}
+
+	if n.VersionMode == VersionModeVClock && remote.Siblings != nil {
+		var local []Sibling
+		if exists {
+			local = current.Siblings
+		}
+		merged := reconcileSiblings(append(append([]Sibling{}, local...), remote.Siblings...))
+		if exists && sameSiblings(merged, local) {
+			return false
+		}
+		entry := entryFromSiblings(remote.Key, merged)
+		entry.DeletedAt = remote.DeletedAt
+		n.applyEntry(entry)
+		return true
+	}
+
+	if exists && !remote.Version.NewerThan(current.Version) {
+		return false
+	}
+	remote.Siblings = nil
+	n.applyEntry(remote)
+	return true
+}
+
+// Lamportクロックの受信時更新
+func (n *Node) observeClock(clock uint64) {
+	if clock > n.Clock {
+		n.Clock = clock
+	}
+}
+
+// 呼び出し側でロックを保持していること
+func (n *Node) applyEntry(entry Entry) {
+	entry.tombstoneAcks = nil
+	if entry.Deleted {
+		if entry.DeletedAt == 0 {
+			entry.DeletedAt = time.Now().UnixMilli()
+		}
+		entry.tombstoneAcks = make(map[string]bool)
+	} else {
+		entry.DeletedAt = 0
+	}
+
+	if entry.Deleted {
+		log.Printf("[%s] Key '%s' deleted: tombstone @%d/%s", n.ID, entry.Key,
+			entry.Version.Clock, entry.Version.NodeID)
+	} else if current, ok := n.Store[entry.Key]; ok {
+		log.Printf("[%s] Key '%s' updated: '%s'@%d/%s -> '%s'@%d/%s", n.ID, entry.Key,
+			current.Value, current.Version.Clock, current.Version.NodeID,
+			entry.Value, entry.Version.Clock, entry.Version.NodeID)
+	} else {
+		log.Printf("[%s] Key '%s' created: '%s'@%d/%s", n.ID, entry.Key,
+			entry.Value, entry.Version.Clock, entry.Version.NodeID)
+	}
+	if len(entry.Siblings) > 1 {
+		log.Printf("[%s] Concurrent writes detected on '%s': %d siblings",
+			n.ID, entry.Key, len(entry.Siblings))
+	}
+	n.Store[entry.Key] = &entry
+	n.LastSeen = time.Now().Unix()
+	n.recordEntryDelta(entry.Key)
+	n.updateMerkleEntry(&entry)
+	n.markHotRumor(merkleEntryPrefix + entry.Key)
+}
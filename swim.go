@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 故障検出方式
+const (
+	FailureDetectorNone = "none"
+	FailureDetectorSWIM = "swim"
+)
+
+// メンバーの状態（SWIM）
+const (
+	MemberAlive   = "alive"
+	MemberSuspect = "suspect"
+	MemberDead    = "dead"
+)
+
+// SWIMのメッセージ種別
+const (
+	SwimPing    = "PING"
+	SwimPingReq = "PING_REQ"
+)
+
+// 1メッセージに載せる更新の上限
+const swimMaxPiggyback = 8
+
+// SWIMのパラメータ
+//   - Interval: プローブ周期
+//   - Timeout: PINGの応答待ち時間（PING_REQはこの2倍まで待つ）
+//   - IndirectK: 直接PINGに失敗したときにPING_REQを依頼するメンバー数
+//   - SuspicionTimeout: suspectのまま反論がなければdeadとするまでの時間
+type SwimConfig struct {
+	Interval         time.Duration
+	Timeout          time.Duration
+	IndirectK        int
+	SuspicionTimeout time.Duration
+}
+
+// メンバーの状態変化（PING/ACKとゴシップメッセージに相乗りして広まる）
+type MemberUpdate struct {
+	Address     string `json:"address"`
+	State       string `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+}
+
+type SwimMessage struct {
+	Type    string         `json:"type"`
+	From    string         `json:"from"`
+	Target  string         `json:"target,omitempty"`
+	Updates []MemberUpdate `json:"updates,omitempty"`
+}
+
+type SwimAck struct {
+	Ack     bool           `json:"ack"`
+	Updates []MemberUpdate `json:"updates,omitempty"`
+}
+
+// JSON出力用のメンバー状態
+type MemberStatus struct {
+	Address     string `json:"address"`
+	State       string `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+	SinceMs     int64  `json:"since_ms"`
+}
+
+type swimMember struct {
+	state       string
+	incarnation uint64
+	since       time.Time
+}
+
+// 未送信回数が残っている更新
+type swimBroadcast struct {
+	update    MemberUpdate
+	remaining int
+}
+
+type swimState struct {
+	mu          sync.Mutex
+	config      SwimConfig
+	client      *http.Client
+	incarnation uint64
+	members     map[string]*swimMember
+	broadcasts  map[string]*swimBroadcast
+	// プローブ順（シャッフルしたメンバーを順に巡回する）
+	probeOrder []string
+}
+
+func newSwimState(config SwimConfig) *swimState {
+	return &swimState{
+		config:     config,
+		client:     &http.Client{Timeout: config.Timeout},
+		members:    map[string]*swimMember{},
+		broadcasts: map[string]*swimBroadcast{},
+	}
+}
+
+// SWIMが有効か
+func (n *Node) swimEnabled() bool {
+	return n.swim != nil
+}
+
+// Peersに新しく現れたアドレスをaliveのメンバーとして加える
+func (n *Node) syncSwimMembers() {
+	n.mu.RLock()
+	peers := append([]string(nil), n.Peers...)
+	n.mu.RUnlock()
+
+	n.swim.mu.Lock()
+	defer n.swim.mu.Unlock()
+	for _, peer := range peers {
+		if _, ok := n.swim.members[peer]; !ok {
+			n.swim.members[peer] = &swimMember{state: MemberAlive, since: time.Now()}
+		}
+	}
+}
+
+// 定期プローブループ
+func (n *Node) StartFailureDetector() {
+	if !n.swimEnabled() || n.swim.config.Interval <= 0 {
+		return
+	}
+
+	n.spawn(func() {
+		if !n.sleep(time.Duration(rand.Int63n(int64(n.swim.config.Interval)))) {
+			return
+		}
+		ticker := time.NewTicker(n.swim.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-n.quit:
+				return
+			case <-ticker.C:
+			}
+			if !n.HasLeft() {
+				n.probe()
+			}
+		}
+	})
+}
+
+// 次のプローブ先（deadを除くメンバーをシャッフルした順に巡回する）
+func (n *Node) nextProbeTarget() string {
+	n.swim.mu.Lock()
+	defer n.swim.mu.Unlock()
+
+	for len(n.swim.probeOrder) > 0 {
+		target := n.swim.probeOrder[0]
+		n.swim.probeOrder = n.swim.probeOrder[1:]
+		if member, ok := n.swim.members[target]; ok && member.state != MemberDead {
+			return target
+		}
+	}
+	for address, member := range n.swim.members {
+		if member.state != MemberDead {
+			n.swim.probeOrder = append(n.swim.probeOrder, address)
+		}
+	}
+	sort.Strings(n.swim.probeOrder)
+	rand.Shuffle(len(n.swim.probeOrder), func(i, j int) {
+		n.swim.probeOrder[i], n.swim.probeOrder[j] = n.swim.probeOrder[j], n.swim.probeOrder[i]
+	})
+	if len(n.swim.probeOrder) == 0 {
+		return ""
+	}
+	target := n.swim.probeOrder[0]
+	n.swim.probeOrder = n.swim.probeOrder[1:]
+	return target
+}
+
+// 1回のプローブ: 直接PING、失敗したらk個のメンバー経由でPING_REQ、それも失敗したらsuspect
+func (n *Node) probe() {
+	n.syncSwimMembers()
+	target := n.nextProbeTarget()
+	if target == "" {
+		return
+	}
+	if n.ping(target) {
+		return
+	}
+
+	helpers := n.indirectHelpers(target)
+	acked := make(chan bool, len(helpers))
+	for _, helper := range helpers {
+		go func(helper string) {
+			var ack SwimAck
+			err := n.swimPost(helper, SwimMessage{Type: SwimPingReq, From: n.Address, Target: target}, &ack, 2*n.swim.config.Timeout)
+			acked <- err == nil && ack.Ack
+		}(helper)
+	}
+	for range helpers {
+		if <-acked {
+			return
+		}
+	}
+
+	log.Printf("[%s] SWIM: %s did not respond to ping or %d ping-reqs", n.ID, target, len(helpers))
+	n.suspect(target)
+}
+
+// PINGしてACKが返ればtrue
+func (n *Node) ping(target string) bool {
+	var ack SwimAck
+	err := n.swimPost(target, SwimMessage{Type: SwimPing, From: n.Address}, &ack, n.swim.config.Timeout)
+	return err == nil && ack.Ack
+}
+
+// PING_REQを依頼するメンバー（target以外のaliveなメンバーからランダムにk個）
+func (n *Node) indirectHelpers(target string) []string {
+	n.swim.mu.Lock()
+	defer n.swim.mu.Unlock()
+
+	var candidates []string
+	for address, member := range n.swim.members {
+		if address != target && member.state == MemberAlive {
+			candidates = append(candidates, address)
+		}
+	}
+	sort.Strings(candidates)
+	return randomSubset(candidates, n.swim.config.IndirectK)
+}
+
+// SWIMメッセージを送る（更新を相乗りさせ、応答の更新を取り込む）
+func (n *Node) swimPost(target string, message SwimMessage, ack *SwimAck, timeout time.Duration) error {
+	if err := n.injectFault(); err != nil {
+		return err
+	}
+	message.Updates = n.swimPiggyback()
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	client := n.swim.client
+	if timeout != client.Timeout {
+		client = &http.Client{Timeout: timeout}
+	}
+	ctx, cancel := context.WithTimeout(n.ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/swim", target), bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(ack); err != nil {
+		return err
+	}
+	n.applyMemberUpdates(ack.Updates)
+	return nil
+}
+
+// SWIMメッセージ受信処理
+// PINGには即座にACKし、PING_REQは代わりにtargetへPINGして結果を返す
+func (n *Node) HandleSwim(message SwimMessage) SwimAck {
+	n.applyMemberUpdates(message.Updates)
+	n.markAlive(message.From)
+
+	ack := true
+	if message.Type == SwimPingReq {
+		ack = n.ping(message.Target)
+	}
+	return SwimAck{Ack: ack, Updates: n.swimPiggyback()}
+}
+
+// 未知のノードからメッセージを受け取ったらaliveのメンバーとして加える
+// （suspect/deadからの復帰は本人の反論でのみ行う）
+// suspect/deadのメンバーから届いた場合は、その判定を再び相乗りさせて応答で本人へ伝え、
+// 復旧したノードがincarnationを上げて反論できるようにする（deadのメンバーはプローブされないため）
+func (n *Node) markAlive(address string) {
+	if address == "" || address == n.Address {
+		return
+	}
+	n.swim.mu.Lock()
+	defer n.swim.mu.Unlock()
+	member, ok := n.swim.members[address]
+	if !ok {
+		n.swim.members[address] = &swimMember{state: MemberAlive, since: time.Now()}
+		return
+	}
+	if member.state != MemberAlive {
+		n.queueMemberUpdateLocked(MemberUpdate{Address: address, State: member.state, Incarnation: member.incarnation})
+	}
+}
+
+// プローブに失敗したメンバーをsuspectにし、期限までに反論がなければdeadにする
+func (n *Node) suspect(target string) {
+	n.swim.mu.Lock()
+	member, ok := n.swim.members[target]
+	if !ok || member.state != MemberAlive {
+		n.swim.mu.Unlock()
+		return
+	}
+	incarnation := member.incarnation
+	n.setMemberLocked(target, MemberSuspect, incarnation)
+	n.swim.mu.Unlock()
+
+	// 期限切れの判定もspawnで実行し、停止後にdeadへ変えないようにする
+	time.AfterFunc(n.swim.config.SuspicionTimeout, func() { n.spawn(func() { n.confirmSuspect(target, incarnation) }) })
+}
+
+// suspectのまま反論がなければdeadにする
+func (n *Node) confirmSuspect(target string, incarnation uint64) {
+	n.swim.mu.Lock()
+	member, ok := n.swim.members[target]
+	confirmed := ok && member.state == MemberSuspect && member.incarnation == incarnation
+	if confirmed {
+		n.setMemberLocked(target, MemberDead, incarnation)
+	}
+	n.swim.mu.Unlock()
+	if confirmed {
+		n.handlePeerFailure(target)
+	}
+}
+
+// メンバーの状態を変更し、更新として広める（呼び出し側でswim.muを保持していること）
+func (n *Node) setMemberLocked(address, state string, incarnation uint64) {
+	member, ok := n.swim.members[address]
+	if !ok {
+		member = &swimMember{}
+		n.swim.members[address] = member
+	}
+	if member.state != state {
+		log.Printf("[%s] SWIM: %s is %s (incarnation %d)", n.ID, address, state, incarnation)
+	}
+	member.state = state
+	member.incarnation = incarnation
+	member.since = time.Now()
+	n.queueMemberUpdateLocked(MemberUpdate{Address: address, State: state, Incarnation: incarnation})
+}
+
+// 更新を約λlog(n)回相乗りさせる（呼び出し側でswim.muを保持していること）
+func (n *Node) queueMemberUpdateLocked(update MemberUpdate) {
+	retransmit := 3 * int(math.Ceil(math.Log2(float64(len(n.swim.members)+2))))
+	n.swim.broadcasts[update.Address] = &swimBroadcast{update: update, remaining: retransmit}
+}
+
+// 相乗りさせる更新（送信回数の少ないものから）
+func (n *Node) swimPiggyback() []MemberUpdate {
+	if !n.swimEnabled() {
+		return nil
+	}
+	n.swim.mu.Lock()
+	defer n.swim.mu.Unlock()
+
+	pending := make([]*swimBroadcast, 0, len(n.swim.broadcasts))
+	for _, broadcast := range n.swim.broadcasts {
+		pending = append(pending, broadcast)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].remaining != pending[j].remaining {
+			return pending[i].remaining > pending[j].remaining
+		}
+		return pending[i].update.Address < pending[j].update.Address
+	})
+
+	var updates []MemberUpdate
+	for _, broadcast := range pending {
+		if len(updates) == swimMaxPiggyback {
+			break
+		}
+		updates = append(updates, broadcast.update)
+		broadcast.remaining--
+		if broadcast.remaining <= 0 {
+			delete(n.swim.broadcasts, broadcast.update.Address)
+		}
+	}
+	return updates
+}
+
+// 受け取った更新を取り込む（SWIMの優先規則）
+//   - alive(i)はincarnationがより大きい場合のみ上書きする
+//   - suspect(i)はalive(j≤i)とsuspect(j<i)を上書きする
+//   - deadは常に上書きする
+//
+// 自分についてのsuspect/deadはincarnationを上げたaliveで反論する
+func (n *Node) applyMemberUpdates(updates []MemberUpdate) {
+	if !n.swimEnabled() {
+		return
+	}
+	var confirmed []string
+	n.swim.mu.Lock()
+	for _, update := range updates {
+		if update.Address == n.Address {
+			if update.State != MemberAlive && update.Incarnation >= n.swim.incarnation {
+				n.swim.incarnation = update.Incarnation + 1
+				log.Printf("[%s] SWIM: refuting %s with incarnation %d", n.ID, update.State, n.swim.incarnation)
+				n.queueMemberUpdateLocked(MemberUpdate{Address: n.Address, State: MemberAlive, Incarnation: n.swim.incarnation})
+			}
+			continue
+		}
+
+		member, known := n.swim.members[update.Address]
+		if !known {
+			n.setMemberLocked(update.Address, update.State, update.Incarnation)
+			if update.State == MemberDead {
+				confirmed = append(confirmed, update.Address)
+			}
+			continue
+		}
+		switch update.State {
+		case MemberAlive:
+			// deadと判定されたノードも、より大きいincarnationで反論すれば復帰する
+			if update.Incarnation > member.incarnation {
+				n.setMemberLocked(update.Address, MemberAlive, update.Incarnation)
+			}
+		case MemberSuspect:
+			if member.state == MemberDead {
+				continue
+			}
+			if (member.state == MemberAlive && update.Incarnation >= member.incarnation) ||
+				(member.state == MemberSuspect && update.Incarnation > member.incarnation) {
+				n.setMemberLocked(update.Address, MemberSuspect, update.Incarnation)
+			}
+		case MemberDead:
+			if member.state == MemberDead {
+				continue
+			}
+			n.setMemberLocked(update.Address, MemberDead, update.Incarnation)
+			confirmed = append(confirmed, update.Address)
+		}
+	}
+	n.swim.mu.Unlock()
+
+	for _, address := range confirmed {
+		n.handlePeerFailure(address)
+	}
+}
+
+// deadと判定されたメンバーか
+func (n *Node) isDead(address string) bool {
+	if !n.swimEnabled() {
+		return false
+	}
+	n.swim.mu.Lock()
+	defer n.swim.mu.Unlock()
+	member, ok := n.swim.members[address]
+	return ok && member.state == MemberDead
+}
+
+// 自ノードから見たメンバーの状態（アドレス順）
+func (n *Node) MemberStatuses() []MemberStatus {
+	if !n.swimEnabled() {
+		return nil
+	}
+	n.swim.mu.Lock()
+	defer n.swim.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]MemberStatus, 0, len(n.swim.members))
+	for address, member := range n.swim.members {
+		statuses = append(statuses, MemberStatus{
+			Address:     address,
+			State:       member.state,
+			Incarnation: member.incarnation,
+			SinceMs:     now.Sub(member.since).Milliseconds(),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Address < statuses[j].Address })
+	return statuses
+}
+
+// 自ノードのincarnation
+func (n *Node) Incarnation() uint64 {
+	if !n.swimEnabled() {
+		return 0
+	}
+	n.swim.mu.Lock()
+	defer n.swim.mu.Unlock()
+	return n.swim.incarnation
+}
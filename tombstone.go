@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// ピアが持っていると分かったtombstoneを、そのピアの確認済みとして記録する
+// 送信に成功したもの（受信側は同期的にマージしてから200を返すため、送信成功は受領を意味する）と、
+// ダイジェストやMerkle木の比較で相手も同じバージョンを持つと分かったものが対象
+// 手元のバージョンが変わっていれば記録しない
+func (n *Node) recordTombstoneAcks(peer string, sent []Entry) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, s := range sent {
+		if !s.Deleted {
+			continue
+		}
+		current, ok := n.Store[s.Key]
+		if ok && current.Deleted && current.Version == s.Version {
+			current.tombstoneAcks[peer] = true
+		}
+	}
+}
+
+// 猶予期間を過ぎ、かつ現在の送信先候補がすべて確認済みのtombstoneを削除する
+// 削除したtombstoneの数を返す
+func (n *Node) PurgeTombstones() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	purged := 0
+	for key, entry := range n.Store {
+		if !entry.Deleted || time.Since(time.UnixMilli(entry.DeletedAt)) < n.TombstoneGrace {
+			continue
+		}
+		if !n.allPeersAcked(entry) {
+			continue
+		}
+		delete(n.Store, key)
+		n.merkle.Remove(merkleEntryPrefix + key)
+		if entry.Version.NewerThan(n.purged[key]) {
+			n.purged[key] = entry.Version
+		}
+		purged++
+		log.Printf("[%s] Tombstone for '%s' purged (@%d/%s)",
+			n.ID, key, entry.Version.Clock, entry.Version.NodeID)
+	}
+	return purged
+}
+
+// 呼び出し側でロックを保持していること
+func (n *Node) allPeersAcked(entry *Entry) bool {
+	for _, peer := range n.gossipCandidatesLocked() {
+		if !entry.tombstoneAcks[peer] {
+			return false
+		}
+	}
+	return true
+}
+
+// peerの確認がまだないtombstoneのキー（ソート済み）
+func (n *Node) unackedTombstones(peer string) []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	var keys []string
+	for key, entry := range n.Store {
+		if entry.Deleted && !entry.tombstoneAcks[peer] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 現在の送信先候補のいずれかの確認がまだないtombstoneがあるか
+func (n *Node) hasUnackedTombstones() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for _, entry := range n.Store {
+		if entry.Deleted && !n.allPeersAcked(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// 保持しているtombstoneの数
+func (n *Node) TombstoneCount() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.tombstoneCountLocked()
+}
+
+func (n *Node) tombstoneCountLocked() int {
+	count := 0
+	for _, entry := range n.Store {
+		if entry.Deleted {
+			count++
+		}
+	}
+	return count
+}
+
+// tombstoneのGCループ
+// TombstoneGraceが0以下の場合はGCしない（tombstoneを永続的に保持）
+func (n *Node) StartTombstoneGC() {
+	if n.TombstoneGrace <= 0 {
+		return
+	}
+
+	interval := n.TombstoneGrace / 2
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+
+	n.spawn(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-n.quit:
+				return
+			case <-ticker.C:
+				n.PurgeTombstones()
+			}
+		}
+	})
+}
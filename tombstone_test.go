@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+const testTombstoneGrace = 50 * time.Millisecond
+
+// 定期ゴシップを止めたpushpullモードのノードを起動する（tombstoneのGCは動く、テスト終了時に停止する）
+func startTestNode(t *testing.T, id string) *Node {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := createNode(id, listener.Addr().String(), nil, NodeConfig{
+		PeerSelection:  PeerSelectionUniform,
+		VersionMode:    VersionModeLWW,
+		GossipMode:     GossipModePushPull,
+		Dissemination:  DisseminationFull,
+		MerkleDepth:    4,
+		PeerSampling:   PeerSamplingStatic,
+		Fanout:         1,
+		TombstoneGrace: testTombstoneGrace,
+	})
+	node.Start(context.Background(), listener)
+	t.Cleanup(node.Stop)
+	return node
+}
+
+// 両ノードが同じtombstoneを持つようになった後、猶予期間を過ぎれば双方で削除される
+// 一方はtombstoneを自分で送っておらず、ダイジェストが一致したことだけで相手の確認を得る
+func TestPushPullPurgesTombstoneHeldByAllPeers(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// tombstoneを作った側aから1回送った後の2回目の交換
+		second func(a, b *Node) error
+	}{
+		{"initiator", func(a, b *Node) error { return b.pushPullGossip(a.Address) }},
+		{"responder", func(a, b *Node) error { return a.pushPullGossip(b.Address) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := startTestNode(t, "node-a")
+			b := startTestNode(t, "node-b")
+			a.setPeers([]string{b.Address})
+			b.setPeers([]string{a.Address})
+
+			a.Set("greeting", "hello", nil)
+			if err := a.pushPullGossip(b.Address); err != nil {
+				t.Fatal(err)
+			}
+			a.Delete("greeting")
+			if err := a.pushPullGossip(b.Address); err != nil {
+				t.Fatal(err)
+			}
+			if b.TombstoneCount() != 1 {
+				t.Fatalf("tombstone not propagated: b has %d tombstones", b.TombstoneCount())
+			}
+			if err := tc.second(a, b); err != nil {
+				t.Fatal(err)
+			}
+
+			deadline := time.Now().Add(20 * testTombstoneGrace)
+			for a.TombstoneCount()+b.TombstoneCount() > 0 && time.Now().Before(deadline) {
+				time.Sleep(testTombstoneGrace / 5)
+			}
+			for _, node := range []*Node{a, b} {
+				if count := node.TombstoneCount(); count != 0 {
+					t.Errorf("%s still holds %d tombstones after the grace period", node.ID, count)
+				}
+			}
+		})
+	}
+}
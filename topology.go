@@ -0,0 +1,447 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// クラスタートポロジー
+const (
+	TopologyFullMesh      = "full-mesh"
+	TopologyRing          = "ring"
+	TopologyStar          = "star"
+	TopologyKRegular      = "k-regular"
+	TopologyErdosRenyi    = "erdos-renyi"
+	TopologyWattsStrogatz = "watts-strogatz"
+	// 設定ファイルで辺を直接指定した場合（生成しない）
+	TopologyCustom = "custom"
+)
+
+// k-regularのペアリングをやり直す上限回数
+const kRegularAttempts = 1000
+
+// ノード番号を頂点とする無向グラフ
+// Neighbors[i]はノードiの隣接ノード番号（昇順）で、ノードiのピアになる
+type Topology struct {
+	Name      string
+	K         int
+	P         float64
+	Seed      int64
+	Neighbors [][]int
+}
+
+// 生成パラメータ
+//   - k-regular: 各ノードの次数K
+//   - erdos-renyi: 辺の存在確率P
+//   - watts-strogatz: リング格子の次数K（偶数）と張り替え確率P
+type TopologyConfig struct {
+	Name string
+	K    int
+	P    float64
+	Seed int64
+}
+
+func generateTopology(config TopologyConfig, nodeCount int) (*Topology, error) {
+	rng := rand.New(rand.NewSource(config.Seed))
+	adjacency := make([]map[int]bool, nodeCount)
+	for i := range adjacency {
+		adjacency[i] = map[int]bool{}
+	}
+	connect := func(a, b int) {
+		adjacency[a][b] = true
+		adjacency[b][a] = true
+	}
+
+	switch config.Name {
+	case TopologyFullMesh:
+		for i := 0; i < nodeCount; i++ {
+			for j := i + 1; j < nodeCount; j++ {
+				connect(i, j)
+			}
+		}
+	case TopologyRing:
+		if nodeCount > 1 {
+			for i := 0; i < nodeCount; i++ {
+				connect(i, (i+1)%nodeCount)
+			}
+		}
+	case TopologyStar:
+		// node-0をハブとする
+		for i := 1; i < nodeCount; i++ {
+			connect(0, i)
+		}
+	case TopologyKRegular:
+		if config.K < 1 || config.K >= nodeCount || (nodeCount*config.K)%2 != 0 {
+			return nil, fmt.Errorf("k-regular requires 1 <= k < nodes and nodes*k even (k=%d, nodes=%d)", config.K, nodeCount)
+		}
+		if !kRegularPairing(rng, adjacency, config.K) {
+			return nil, fmt.Errorf("failed to generate a %d-regular graph on %d nodes", config.K, nodeCount)
+		}
+	case TopologyErdosRenyi:
+		if config.P < 0 || config.P > 1 {
+			return nil, fmt.Errorf("erdos-renyi requires 0 <= p <= 1 (p=%g)", config.P)
+		}
+		for i := 0; i < nodeCount; i++ {
+			for j := i + 1; j < nodeCount; j++ {
+				if rng.Float64() < config.P {
+					connect(i, j)
+				}
+			}
+		}
+	case TopologyWattsStrogatz:
+		if config.K < 2 || config.K%2 != 0 || config.K >= nodeCount {
+			return nil, fmt.Errorf("watts-strogatz requires an even k with 2 <= k < nodes (k=%d, nodes=%d)", config.K, nodeCount)
+		}
+		if config.P < 0 || config.P > 1 {
+			return nil, fmt.Errorf("watts-strogatz requires 0 <= p <= 1 (p=%g)", config.P)
+		}
+		wattsStrogatz(rng, adjacency, config.K, config.P)
+	default:
+		return nil, fmt.Errorf("unknown topology: %s", config.Name)
+	}
+
+	return topologyFromAdjacency(config, adjacency), nil
+}
+
+// 隣接集合からトポロジーを作る（隣接ノード番号は昇順）
+func topologyFromAdjacency(config TopologyConfig, adjacency []map[int]bool) *Topology {
+	topology := &Topology{
+		Name:      config.Name,
+		K:         config.K,
+		P:         config.P,
+		Seed:      config.Seed,
+		Neighbors: make([][]int, len(adjacency)),
+	}
+	for i, neighbors := range adjacency {
+		for j := range neighbors {
+			topology.Neighbors[i] = append(topology.Neighbors[i], j)
+		}
+		sort.Ints(topology.Neighbors[i])
+	}
+	return topology
+}
+
+// 各ノードのピア（アドレス）を無向辺とみなしたトポロジー（addressesの並び順の番号）
+// 一覧にないアドレスへの辺は含めない
+func topologyFromPeers(name string, addresses []string, peers [][]string) *Topology {
+	index := map[string]int{}
+	for i, address := range addresses {
+		index[address] = i
+	}
+	adjacency := make([]map[int]bool, len(addresses))
+	for i := range adjacency {
+		adjacency[i] = map[int]bool{}
+	}
+	for i, list := range peers {
+		for _, peer := range list {
+			if j, ok := index[peer]; ok && j != i {
+				adjacency[i][j] = true
+				adjacency[j][i] = true
+			}
+		}
+	}
+	return topologyFromAdjacency(TopologyConfig{Name: name}, adjacency)
+}
+
+// ペアリングモデルでk-regularグラフを作る
+// 各ノードのk個の「スタブ」をランダムに組み合わせ、自己ループや多重辺が出たらやり直す
+func kRegularPairing(rng *rand.Rand, adjacency []map[int]bool, k int) bool {
+	nodeCount := len(adjacency)
+	for attempt := 0; attempt < kRegularAttempts; attempt++ {
+		for i := range adjacency {
+			adjacency[i] = map[int]bool{}
+		}
+		stubs := make([]int, 0, nodeCount*k)
+		for i := 0; i < nodeCount; i++ {
+			for j := 0; j < k; j++ {
+				stubs = append(stubs, i)
+			}
+		}
+		rng.Shuffle(len(stubs), func(i, j int) { stubs[i], stubs[j] = stubs[j], stubs[i] })
+
+		ok := true
+		for i := 0; i < len(stubs); i += 2 {
+			a, b := stubs[i], stubs[i+1]
+			if a == b || adjacency[a][b] {
+				ok = false
+				break
+			}
+			adjacency[a][b] = true
+			adjacency[b][a] = true
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Watts–Strogatz: 各ノードを両隣k/2個と結ぶリング格子を作り、
+// 各辺の遠い側の端点を確率pでランダムなノードへ張り替える
+func wattsStrogatz(rng *rand.Rand, adjacency []map[int]bool, k int, p float64) {
+	nodeCount := len(adjacency)
+	for i := 0; i < nodeCount; i++ {
+		for offset := 1; offset <= k/2; offset++ {
+			j := (i + offset) % nodeCount
+			adjacency[i][j] = true
+			adjacency[j][i] = true
+		}
+	}
+	for offset := 1; offset <= k/2; offset++ {
+		for i := 0; i < nodeCount; i++ {
+			j := (i + offset) % nodeCount
+			if !adjacency[i][j] || rng.Float64() >= p {
+				continue
+			}
+			// 張り替え先が全て隣接済みなら張り替えない
+			if len(adjacency[i]) >= nodeCount-1 {
+				continue
+			}
+			target := rng.Intn(nodeCount)
+			for target == i || adjacency[i][target] {
+				target = rng.Intn(nodeCount)
+			}
+			delete(adjacency[i], j)
+			delete(adjacency[j], i)
+			adjacency[i][target] = true
+			adjacency[target][i] = true
+		}
+	}
+}
+
+// 無向辺の一覧（a < b、昇順）
+func (t *Topology) Edges() [][2]int {
+	edges := [][2]int{}
+	for i, neighbors := range t.Neighbors {
+		for _, j := range neighbors {
+			if i < j {
+				edges = append(edges, [2]int{i, j})
+			}
+		}
+	}
+	return edges
+}
+
+// 全ノードが連結かどうか（非連結だと一部のノードへ値が届かない）
+func (t *Topology) Connected() bool {
+	if len(t.Neighbors) == 0 {
+		return true
+	}
+	visited := make([]bool, len(t.Neighbors))
+	stack := []int{0}
+	visited[0] = true
+	count := 1
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, j := range t.Neighbors[i] {
+			if !visited[j] {
+				visited[j] = true
+				count++
+				stack = append(stack, j)
+			}
+		}
+	}
+	return count == len(t.Neighbors)
+}
+
+// 隣接集合（Neighborsの複製）
+func (t *Topology) adjacency() []map[int]bool {
+	adjacency := make([]map[int]bool, len(t.Neighbors))
+	for i, neighbors := range t.Neighbors {
+		adjacency[i] = map[int]bool{}
+		for _, j := range neighbors {
+			adjacency[i][j] = true
+		}
+	}
+	return adjacency
+}
+
+func (t *Topology) config() TopologyConfig {
+	return TopologyConfig{Name: t.Name, K: t.K, P: t.P, Seed: t.Seed}
+}
+
+// ノードを1つ（番号len(Neighbors)）加えたトポロジー
+// 既存の辺は張り替えが必要なものだけを変え、種類ごとの形（次数など）を保つ
+//   - ring: 最後のノードとnode-0の間に入る
+//   - star: ハブ（node-0）とつなぐ
+//   - k-regular / watts-strogatz: 端点の重ならないk/2本の辺を選び、各辺の間に入る（次数を保つ）
+//   - erdos-renyi: 既存の各ノードと確率Pでつなぐ
+func (t *Topology) withNode(rng *rand.Rand) (*Topology, error) {
+	adjacency := append(t.adjacency(), map[int]bool{})
+	n := len(adjacency) - 1
+	connect := func(a, b int) {
+		adjacency[a][b] = true
+		adjacency[b][a] = true
+	}
+
+	switch t.Name {
+	case TopologyFullMesh:
+		for i := 0; i < n; i++ {
+			connect(i, n)
+		}
+	case TopologyRing:
+		if n > 2 {
+			delete(adjacency[n-1], 0)
+			delete(adjacency[0], n-1)
+		}
+		if n >= 1 {
+			connect(n-1, n)
+		}
+		if n >= 2 {
+			connect(n, 0)
+		}
+	case TopologyStar:
+		if n > 0 {
+			connect(0, n)
+		}
+	case TopologyKRegular:
+		if t.K < 1 || t.K >= n+1 || ((n+1)*t.K)%2 != 0 {
+			return nil, fmt.Errorf("k-regular requires 1 <= k < nodes and nodes*k even (k=%d, nodes=%d)", t.K, n+1)
+		}
+		if !spliceNode(rng, adjacency, n, t.K/2) {
+			return nil, fmt.Errorf("failed to add a node to the %d-regular graph on %d nodes", t.K, n)
+		}
+	case TopologyErdosRenyi:
+		for i := 0; i < n; i++ {
+			if rng.Float64() < t.P {
+				connect(i, n)
+			}
+		}
+	case TopologyWattsStrogatz:
+		if t.K >= n+1 {
+			return nil, fmt.Errorf("watts-strogatz requires an even k with 2 <= k < nodes (k=%d, nodes=%d)", t.K, n+1)
+		}
+		if !spliceNode(rng, adjacency, n, t.K/2) {
+			return nil, fmt.Errorf("failed to add a node to the watts-strogatz graph on %d nodes", n)
+		}
+	}
+	return topologyFromAdjacency(t.config(), adjacency), nil
+}
+
+// ノードindexを除いたトポロジー（indexより後のノードの番号は1つずつ詰める）
+// 除いたノードの隣接ノード同士をつなぎ直して、種類ごとの形を保つ
+//   - ring: 両隣をつなぐ
+//   - star: ハブを除いた場合は新しいnode-0をハブにする
+//   - k-regular / watts-strogatz: 隣接ノードを2つずつ組にしてつなぐ（k-regularは次数を保てなければエラー）
+func (t *Topology) withoutNode(index int, rng *rand.Rand) (*Topology, error) {
+	source := t.adjacency()
+	relabel := func(i int) int {
+		if i > index {
+			return i - 1
+		}
+		return i
+	}
+	adjacency := make([]map[int]bool, 0, len(source)-1)
+	for i, neighbors := range source {
+		if i == index {
+			continue
+		}
+		relabelled := map[int]bool{}
+		for j := range neighbors {
+			if j != index {
+				relabelled[relabel(j)] = true
+			}
+		}
+		adjacency = append(adjacency, relabelled)
+	}
+	orphans := make([]int, 0, len(source[index]))
+	for j := range source[index] {
+		orphans = append(orphans, relabel(j))
+	}
+	sort.Ints(orphans)
+	n := len(adjacency)
+	connect := func(a, b int) {
+		adjacency[a][b] = true
+		adjacency[b][a] = true
+	}
+
+	switch t.Name {
+	case TopologyRing:
+		if len(orphans) == 2 && n > 2 {
+			connect(orphans[0], orphans[1])
+		}
+	case TopologyStar:
+		if index == 0 {
+			for i := 1; i < n; i++ {
+				connect(0, i)
+			}
+		}
+	case TopologyKRegular:
+		if t.K < 1 || t.K >= n || (n*t.K)%2 != 0 {
+			return nil, fmt.Errorf("k-regular requires 1 <= k < nodes and nodes*k even (k=%d, nodes=%d)", t.K, n)
+		}
+		if !pairOrphans(rng, adjacency, orphans, true) {
+			return nil, fmt.Errorf("failed to keep the graph %d-regular after removing a node", t.K)
+		}
+	case TopologyWattsStrogatz:
+		pairOrphans(rng, adjacency, orphans, false)
+	}
+	return topologyFromAdjacency(t.config(), adjacency), nil
+}
+
+// 端点の重ならないcount本の辺をランダムに選び、各辺(a, b)をa-node-bに張り替える
+// 選べなければadjacencyを変えずにfalseを返す
+func spliceNode(rng *rand.Rand, adjacency []map[int]bool, node, count int) bool {
+	edges := topologyFromAdjacency(TopologyConfig{}, adjacency[:node]).Edges()
+	for attempt := 0; attempt < kRegularAttempts; attempt++ {
+		rng.Shuffle(len(edges), func(i, j int) { edges[i], edges[j] = edges[j], edges[i] })
+		used := map[int]bool{}
+		var chosen [][2]int
+		for _, edge := range edges {
+			if len(chosen) == count {
+				break
+			}
+			if used[edge[0]] || used[edge[1]] {
+				continue
+			}
+			used[edge[0]], used[edge[1]] = true, true
+			chosen = append(chosen, edge)
+		}
+		if len(chosen) < count {
+			continue
+		}
+		for _, edge := range chosen {
+			a, b := edge[0], edge[1]
+			delete(adjacency[a], b)
+			delete(adjacency[b], a)
+			adjacency[a][node], adjacency[node][a] = true, true
+			adjacency[b][node], adjacency[node][b] = true, true
+		}
+		return true
+	}
+	return false
+}
+
+// orphansを2つずつ組にしてつなぐ（既に隣接している組は作らない）
+// strictなら全員を組にできた場合だけadjacencyを変えてtrueを返し、
+// そうでなければ組にできた分だけつなぐ
+func pairOrphans(rng *rand.Rand, adjacency []map[int]bool, orphans []int, strict bool) bool {
+	for attempt := 0; attempt < kRegularAttempts; attempt++ {
+		rng.Shuffle(len(orphans), func(i, j int) { orphans[i], orphans[j] = orphans[j], orphans[i] })
+		paired := map[int]bool{}
+		var pairs [][2]int
+		for i, a := range orphans {
+			if paired[a] {
+				continue
+			}
+			for _, b := range orphans[i+1:] {
+				if !paired[b] && !adjacency[a][b] {
+					paired[a], paired[b] = true, true
+					pairs = append(pairs, [2]int{a, b})
+					break
+				}
+			}
+		}
+		if strict && len(paired) < len(orphans) {
+			continue
+		}
+		for _, pair := range pairs {
+			adjacency[pair[0]][pair[1]] = true
+			adjacency[pair[1]][pair[0]] = true
+		}
+		return len(paired) == len(orphans)
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// バージョン管理モード
+const (
+	VersionModeLWW    = "lww"    // Lamportクロックによる後勝ち
+	VersionModeVClock = "vclock" // ベクタークロックによる競合検出（siblingを保持）
+)
+
+// 論理バージョン（Lamportクロック + 発生元ノードID）
+type Version struct {
+	Clock  uint64 `json:"clock"`
+	NodeID string `json:"node_id"`
+}
+
+// vがotherより新しいか
+// クロックが同じ場合はノードIDで決定的に順序付けする
+func (v Version) NewerThan(other Version) bool {
+	if v.Clock != other.Clock {
+		return v.Clock > other.Clock
+	}
+	return v.NodeID > other.NodeID
+}
+
+// ベクタークロック（ノードID -> カウンタ）
+type VectorClock map[string]uint64
+
+// ベクタークロック同士の順序関係
+type ClockOrdering int
+
+const (
+	ClockEqual ClockOrdering = iota
+	ClockBefore
+	ClockAfter
+	ClockConcurrent
+)
+
+func (vc VectorClock) Copy() VectorClock {
+	c := make(VectorClock, len(vc))
+	for id, counter := range vc {
+		c[id] = counter
+	}
+	return c
+}
+
+// 要素ごとの最大値を取ったクロックを返す
+func (vc VectorClock) Merge(other VectorClock) VectorClock {
+	merged := vc.Copy()
+	for id, counter := range other {
+		if counter > merged[id] {
+			merged[id] = counter
+		}
+	}
+	return merged
+}
+
+// vcとotherの因果関係を判定する
+func (vc VectorClock) Compare(other VectorClock) ClockOrdering {
+	less, greater := false, false
+	for id, counter := range vc {
+		if counter > other[id] {
+			greater = true
+		} else if counter < other[id] {
+			less = true
+		}
+	}
+	for id, counter := range other {
+		if _, ok := vc[id]; !ok && counter > 0 {
+			less = true
+		}
+	}
+
+	switch {
+	case less && greater:
+		return ClockConcurrent
+	case less:
+		return ClockBefore
+	case greater:
+		return ClockAfter
+	default:
+		return ClockEqual
+	}
+}
+
+// /set の context パラメータ用のエンコード（base64url + JSON）
+func EncodeContext(vc VectorClock) string {
+	data, _ := json.Marshal(vc)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeContext(s string) (VectorClock, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid context encoding: %v", err)
+	}
+	var vc VectorClock
+	if err := json.Unmarshal(data, &vc); err != nil {
+		return nil, fmt.Errorf("invalid context: %v", err)
+	}
+	return vc, nil
+}